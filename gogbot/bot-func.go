@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
 	yc "github.com/yandex-cloud/go-sdk"
@@ -14,9 +15,9 @@ import (
 	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
 )
 
-func RunBot(cookies []*http.Cookie) (digest []string, err error) {
+func RunBot(cookies []*http.Cookie, retry RetryPolicy) (digest []DigestEvent, err error) {
 	bot := &TheBot{}
-	err = bot.initBot()
+	err = bot.initBot(retry)
 	if err != nil {
 		fmt.Println("error during bot initialization.", err)
 		return
@@ -36,6 +37,8 @@ func RunBot(cookies []*http.Cookie) (digest []string, err error) {
 
 // Requirements for execution:
 // Set YDB_DATABASE : a name for YDB (shown in yandex cloud console)
+// Set GOG_RETRY_ATTEMPTS environment variable (optional) - calls of failed gog request including the first one (default 3, -1 - no retries)
+// Set GOG_RETRY_TIMEOUT environment variable (optional) - seconds for all attempts of one request (default 15)
 func RunGOGBOTFunc(ctx context.Context) (*Response, error) {
 	dbName := os.Getenv("YDB_DATABASE")
 	if len(dbName) == 0 {
@@ -106,7 +109,9 @@ func RunGOGBOTFunc(ctx context.Context) (*Response, error) {
 		fmt.Println("Can't read from db", err)
 	}
 
-	digest, err := RunBot(cookies)
+	attempts, _ := strconv.Atoi(os.Getenv("GOG_RETRY_ATTEMPTS"))
+	timeout, _ := strconv.Atoi(os.Getenv("GOG_RETRY_TIMEOUT"))
+	digest, err := RunBot(cookies, populateRetry(attempts, timeout))
 	if err != nil {
 		return nil, fmt.Errorf("bot error: %v", err)
 	}
@@ -114,10 +119,14 @@ func RunGOGBOTFunc(ctx context.Context) (*Response, error) {
 	if len(digest) > 0 {
 		fmt.Println("update digest")
 		err = db.Table().Do(connectCtx, func(ctxSession context.Context, session table.Session) (err error) {
-			msgs := make([]types.Value, 0, len(digest))
-			for _, m := range digest {
-				msgs = append(msgs, types.StructValue(
-					types.StructFieldValue("msg", types.UTF8Value(m)),
+			events := make([]types.Value, 0, len(digest))
+			for _, e := range digest {
+				events = append(events, types.StructValue(
+					types.StructFieldValue("id", types.UTF8Value(e.ID)),
+					types.StructFieldValue("time", types.Int64Value(e.Time)),
+					types.StructFieldValue("kind", types.UTF8Value(e.Kind)),
+					types.StructFieldValue("payload", types.UTF8Value(e.Payload)),
+					types.StructFieldValue("text", types.UTF8Value(e.Text)),
 				))
 			}
 
@@ -126,18 +135,23 @@ func RunGOGBOTFunc(ctx context.Context) (*Response, error) {
 				table.CommitTx(),
 			)
 
+			// digest_events table is created with sgbot migrations
 			_, _, err = session.Execute(ctxSession, txc,
 				`--!syntax_v1
-				DECLARE $messages AS List<Struct<
-					msg: Utf8>>;
-
-				REPLACE INTO digest
-				SELECT msg AS message FROM AS_TABLE($messages);
+				DECLARE $events AS List<Struct<
+					id: Utf8,
+					time: Int64,
+					kind: Utf8,
+					payload: Utf8,
+					text: Utf8>>;
+
+				UPSERT INTO digest_events
+				SELECT id, time, "gogbot"u AS source, ""u AS account, kind, payload, text FROM AS_TABLE($events);
 				`,
-				table.NewQueryParameters(table.ValueParam("$messages", types.ListValue(msgs...))),
+				table.NewQueryParameters(table.ValueParam("$events", types.ListValue(events...))),
 			)
 			if err != nil {
-				fmt.Println("can't insert into 'digest'", err)
+				fmt.Println("can't insert into 'digest_events'", err)
 				return
 			}
 			return
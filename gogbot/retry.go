@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryAttempts int = 3
+	defaultRetryTimeout  int = 15 // seconds
+)
+
+// RetryPolicy limits retries of gog requests (the same as sgbot one)
+type RetryPolicy struct {
+	Attempts  int           // calls including the first one, <= 1 - no retries
+	BaseDelay time.Duration // delay before the first retry, doubled for every next one (with jitter)
+	MaxDelay  time.Duration // the longest delay. Retry-After above it stops retries
+	MaxTotal  time.Duration // time for all attempts, 0 - no limit
+}
+
+func defaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  defaultRetryAttempts,
+		BaseDelay: 500 * time.Millisecond,
+		MaxDelay:  5 * time.Second,
+		MaxTotal:  time.Duration(defaultRetryTimeout) * time.Second,
+	}
+}
+
+// populateRetry makes policy of attempts (0 - default, < 0 - no retries) and timeout in seconds (0 - default)
+func populateRetry(attempts int, timeout int) RetryPolicy {
+	policy := defaultRetryPolicy()
+	if attempts < 0 {
+		policy.Attempts = 1
+	} else if attempts > 0 {
+		policy.Attempts = attempts
+	}
+	if timeout > 0 {
+		policy.MaxTotal = time.Duration(timeout) * time.Second
+	}
+	return policy
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAfter parses Retry-After header (seconds or http date), 0 - no header
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if when, err := http.ParseTime(value); err == nil && time.Until(when) > 0 {
+		return time.Until(when)
+	}
+	return 0
+}
+
+// delay before retry after the attempt: jittered exponential backoff or Retry-After if server asks for longer
+func (p RetryPolicy) delay(attempt int, resp *http.Response) (time.Duration, bool) {
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff > p.MaxDelay || backoff < 0 {
+		backoff = p.MaxDelay
+	}
+	if backoff > 0 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		wait := retryAfter(resp.Header)
+		if wait > p.MaxDelay {
+			return 0, false
+		}
+		if wait > backoff {
+			backoff = wait
+		}
+	}
+	return backoff, true
+}
+
+// retryTransport repeats GET requests on network errors, 408, 429 and 5xx answers with the policy
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	if req.Method != http.MethodGet {
+		return t.base.RoundTrip(req)
+	}
+
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		resp, err = t.base.RoundTrip(req)
+		if err == nil && !retryableStatus(resp.StatusCode) || attempt >= t.policy.Attempts || req.Context().Err() != nil {
+			return
+		}
+
+		wait, ok := t.policy.delay(attempt, resp)
+		if !ok {
+			fmt.Println("GOGBOT: retry-after is too long. give up")
+			return
+		}
+		if t.policy.MaxTotal > 0 && time.Since(start)+wait > t.policy.MaxTotal {
+			return
+		}
+
+		if resp != nil {
+			fmt.Println("GOGBOT: retry after code:", resp.StatusCode)
+			resp.Body.Close()
+		} else {
+			fmt.Println("GOGBOT: retry after error:", err)
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(wait):
+		}
+	}
+}
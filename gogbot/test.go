@@ -55,7 +55,7 @@ func startBot() {
 	stdlog.Println("bot started")
 
 	bot := &TheBot{}
-	err := bot.initBot()
+	err := bot.initBot(defaultRetryPolicy())
 	if err != nil {
 		errlog.Println("error while initialize bot.", err)
 		return
@@ -1,6 +1,9 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/cookiejar"
@@ -23,19 +26,42 @@ const (
 	claim               string = "/giveaway/claim"
 )
 
+// kinds of digest events (see sgbot events.go)
+const (
+	eventWin         string = "win"
+	eventAuthExpired string = "auth-expired"
+)
+
+// DigestEvent row of digest_events table. the table is created by sgbot migrations,
+// gogbot is a separate module and keeps own copy of the row (see sgbot events.go)
+type DigestEvent struct {
+	ID      string
+	Time    int64
+	Kind    string
+	Payload string // json
+	Text    string
+}
+
+func newEvent(kind string, payload map[string]interface{}, text string) DigestEvent {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	raw, _ := json.Marshal(payload)
+	return DigestEvent{ID: hex.EncodeToString(id), Time: time.Now().Unix(), Kind: kind, Payload: string(raw), Text: text}
+}
+
 type TheBot struct {
 	// http client
 	client          *http.Client
 	cookies         []*http.Cookie
 }
 
-func (b *TheBot) initBot() error {
+func (b *TheBot) initBot(retry RetryPolicy) error {
 	jar, err := cookiejar.New(&cookiejar.Options{})
 	if err != nil {
 		return err
 	}
 
-	b.client = &http.Client{Jar: jar}
+	b.client = &http.Client{Jar: jar, Transport: &retryTransport{base: http.DefaultTransport, policy: retry}}
 	return nil
 }
 
@@ -72,7 +98,7 @@ func (b *TheBot) getPageCustom(uri string) (retCode int, err error) {
 	return
 }
 
-func (b *TheBot) claimGiveaway() (digest []string, err error) {
+func (b *TheBot) claimGiveaway() (digest []DigestEvent, err error) {
 	code, err := b.getPageCustom(baseURL + claim)
 
 	if err != nil {
@@ -82,15 +108,16 @@ func (b *TheBot) claimGiveaway() (digest []string, err error) {
 
 	fmt.Println("GOGBOT: returned code:", code)
 
-	response := make([]string, 0)
+	response := make([]DigestEvent, 0)
+	payload := map[string]interface{}{"status": code}
 
 	switch code {
 	case http.StatusOK:
 	case http.StatusCreated:
-		response = append(response, fmt.Sprintf("%s. GOGBOT: claimed something", time.Now().Format("15:04:05")))
+		response = append(response, newEvent(eventWin, payload, "GOGBOT: claimed something"))
 
 	case http.StatusUnauthorized:
-		response = append(response, fmt.Sprintf("%s. GOGBOT: unautorized", time.Now().Format("15:04:05")))
+		response = append(response, newEvent(eventAuthExpired, payload, "GOGBOT: unautorized"))
 	}
 
 	return response, err
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// defaultAccount - account configured with environment variables and 'cookies' table
+const defaultAccount string = ""
+
+// Account steamgifts account run by the bot (row of 'accounts' table)
+type Account struct {
+	Name          string
+	SteamProfile  string
+	SteamAPIKey   string
+	PointsReserve int
+	Settings      string // json with request fields overriding defaults, like {"sources": [...], "rules": [...], "games": [...]}
+	Cookies       []Cookie
+}
+
+// accountRequest makes request for the account: defaults are overridden with account settings.
+// account games are added to common games list
+func accountRequest(base *Request, account Account) (*Request, error) {
+	raw, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Request{}
+	err = json.Unmarshal(raw, r)
+	if err != nil {
+		return nil, err
+	}
+
+	r.Games = nil
+	if account.Settings != "" {
+		err = json.Unmarshal([]byte(account.Settings), r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid settings of account '%s': %v", account.Name, err)
+		}
+	}
+	r.Games = append(slices.Clone(base.Games), r.Games...)
+
+	r.SteamProfile = account.SteamProfile
+	if account.SteamAPIKey != "" {
+		r.SteamAPIKey = account.SteamAPIKey
+	}
+	if account.PointsReserve > 0 {
+		r.PointsReserve = account.PointsReserve
+	}
+	r.Cookies = account.Cookies
+	r.State = nil
+	r.History = nil
+	r.FetcherHandler = base.FetcherHandler
+	r.SteamHandler = base.SteamHandler
+
+	return r, nil
+}
+
+// accountStateName - state row of the account
+func accountStateName(account string) string {
+	if account == defaultAccount {
+		return stateName
+	}
+	return stateName + ":" + account
+}
+
+// AccountRun account request and results of its run
+type AccountRun struct {
+	Account string
+	Request *Request
+	Digest  []DigestEvent
+	Err     error
+}
+
+// Events digest of the run marked with account. failed run adds its error to events it made before the failure
+func (r *AccountRun) Events() []DigestEvent {
+	events := slices.Clone(r.Digest)
+	if r.Err != nil {
+		kind := eventError
+		if errors.Is(r.Err, ErrAuthExpired) {
+			kind = eventAuthExpired
+		}
+		events = append(events, newEvent(kind, map[string]any{"error": r.Err.Error()}, r.Err.Error()))
+	}
+	return accountEvents(r.Account, events)
+}
+
+// runAccounts runs the bot for every account at once. accounts share nothing but the context,
+// failure of one account doesn't stop others
+func runAccounts(ctx context.Context, runs []*AccountRun) {
+	var wg sync.WaitGroup
+	for _, run := range runs {
+		if run.Err != nil {
+			continue // misconfigured account
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stdlog.Printf("run account '%s', profile: %s\n", run.Account, run.Request.SteamProfile)
+			run.Digest, run.Err = RunBot(ctx, run.Request)
+		}()
+	}
+	wg.Wait()
+}
@@ -2,16 +2,14 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
-
-	yc "github.com/yandex-cloud/go-sdk"
-	ycsdk "github.com/ydb-platform/ydb-go-sdk/v3"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
 )
 
 type Cookie struct {
@@ -26,12 +24,52 @@ type Game struct {
 	Id   uint64 `json:"id"`
 }
 
+const (
+	defaultMaxPages     int = 3
+	defaultPagesTimeout int = 20
+	defaultSearchHours  int = 24
+	defaultReconcile    int = 24
+	defaultRunTimeout   int = 45
+	defaultReserveHours int = 1
+
+	// time kept after the bot run to save state, entries and digest
+	persistTimeout time.Duration = 10 * time.Second
+)
+
 type Request struct {
-	SteamProfile string   `json:"profile"`
-	SteamAPIKey  string   `json:"steam_key"`
-	ZenrowAPIKey string   `json:"zenrow_key"`
-	Cookies      []Cookie `json:"cookies"`
-	Games        []Game   `json:"games"`
+	SteamProfile   string    `json:"profile"`
+	SteamAPIKey    string    `json:"steam_key"`
+	ZenrowAPIKey   string    `json:"zenrow_key"`
+	Fetcher        string    `json:"fetcher"`
+	ProxyURL       string    `json:"proxy"`
+	MaxPages       int       `json:"max_pages"`       // pages per listing, 0 - default, < 0 - no limit
+	PagesTimeout   int       `json:"pages_timeout"`   // seconds to walk one listing, 0 - default, < 0 - no limit
+	SearchBudget   int       `json:"search_budget"`   // search queries for whitelisted games per run, 0 - search disabled
+	SearchBy       string    `json:"search_by"`       // search games by 'app' id (default) or 'name'
+	SearchHours    int       `json:"search_hours"`    // do not search the same game again for hours, 0 - default
+	Sources        []Source  `json:"sources"`         // listings to check, empty - wishlist and main page
+	Pacing         *Pacing   `json:"pacing"`          // pauses and caps for entries, nil - defaults
+	Rules          []Rule    `json:"rules"`           // rules for entering giveaways, empty - whitelisted games
+	PointsReserve  int       `json:"points_reserve"`  // points kept for wishlist giveaways which end soon
+	ReserveHours   int       `json:"reserve_hours"`   // wishlist giveaways which end within hours can spend reserve, 0 - default
+	Scoring        string    `json:"scoring"`         // giveaways ranking: priority (default), chance or time
+	TopWishlist    int       `json:"top_wishlist"`    // wishlist games with priority up to it are entered first, 0 - default, < 0 - none
+	ReconcileHours int       `json:"reconcile_hours"` // check entries with steamgifts every hours, 0 - default, < 0 - never
+	FamilySharing  bool      `json:"family_sharing"`  // skip games shared by steam family members as owned
+	PackagesHours  int       `json:"packages_hours"`  // keep resolved steam packages apps for hours, 0 - default
+	RetryAttempts  int       `json:"retry_attempts"`  // calls of failed request including the first one, 0 - default, < 0 - no retries
+	RetryTimeout   int       `json:"retry_timeout"`   // seconds for all attempts of one request, 0 - default
+	Cookies        []Cookie  `json:"cookies"`
+	Games          []Game    `json:"games"`
+	State          *BotState `json:"state"`
+
+	// entries of not ended giveaways
+	History *EntryHistory `json:"-"`
+
+	// pages source for 'memory' fetcher
+	FetcherHandler http.Handler `json:"-"`
+	// steam api and store source instead of network (for offline runs)
+	SteamHandler http.Handler `json:"-"`
 }
 
 func populateCookies(b *TheBot, botCookies []Cookie) {
@@ -42,34 +80,139 @@ func populateCookies(b *TheBot, botCookies []Cookie) {
 	b.setCookies(cookies)
 }
 
-func populateGames(games []Game) (mapped map[uint64]bool) {
-	mapped = make(map[uint64]bool)
+func populatePagination(b *TheBot, maxPages int, timeout int) {
+	if maxPages == 0 {
+		maxPages = defaultMaxPages
+	}
+	if timeout == 0 {
+		timeout = defaultPagesTimeout
+	}
+	b.setPagination(max(maxPages, 0), time.Duration(max(timeout, 0))*time.Second)
+}
+
+func populateSearch(b *TheBot, budget int, by string, hours int, games []Game) {
+	if hours <= 0 {
+		hours = defaultSearchHours
+	}
+
+	names := make(map[uint64]string)
 	for _, game := range games {
-		mapped[game.Id] = true
+		names[game.Id] = game.Name
+	}
+	b.setSearch(budget, by, time.Duration(hours)*time.Hour, names)
+}
+
+func populateRetry(attempts int, timeout int) RetryPolicy {
+	policy := defaultRetryPolicy()
+	if attempts != 0 {
+		policy.Attempts = max(attempts, 1)
+	}
+	if timeout > 0 {
+		policy.MaxTotal = time.Duration(timeout) * time.Second
+	}
+	return policy
+}
+
+func populateGames(games []Game) (mapped map[uint64]*WhitelistGame) {
+	mapped = make(map[uint64]*WhitelistGame)
+	for _, game := range games {
+		mapped[game.Id] = &WhitelistGame{Lists: []string{listManual}, Name: game.Name}
 	}
 	return
 }
 
 // Check - check page and enter for gifts (repeat by timeout)
-func runCheck(b *TheBot, games map[uint64]bool) (digest []string, err error) {
+func runCheck(ctx context.Context, b *TheBot, games map[uint64]*WhitelistGame) (digest []DigestEvent, err error) {
 	defer fmt.Println("bot check finished")
 
-	err = b.parseGiveaways(games)
+	err = b.parseGiveaways(ctx, games)
 	return b.digest, err
 }
 
-func RunBot(botRequest *Request) (digest []string, err error) {
+func RunBot(ctx context.Context, botRequest *Request) (digest []DigestEvent, err error) {
+	retry := populateRetry(botRequest.RetryAttempts, botRequest.RetryTimeout)
+	fetcher, err := newFetcher(FetcherConfig{
+		Kind:     botRequest.Fetcher,
+		APIKey:   botRequest.ZenrowAPIKey,
+		ProxyURL: botRequest.ProxyURL,
+		Handler:  botRequest.FetcherHandler,
+		Retry:    retry,
+	})
+	if err != nil {
+		fmt.Println("can't create page fetcher.", err)
+		return
+	}
+
+	sources, err := parseSources(botRequest.Sources)
+	if err != nil {
+		fmt.Println("invalid sources configuration.", err)
+		return
+	}
+
+	rules, err := parseRules(botRequest.Rules)
+	if err != nil {
+		fmt.Println("invalid rules.", err)
+		return
+	}
+
+	pacing, err := parsePacing(botRequest.Pacing)
+	if err != nil {
+		fmt.Println("invalid pacing configuration.", err)
+		return
+	}
+
 	bot := &TheBot{}
-	err = bot.InitBot(botRequest.SteamProfile, botRequest.SteamAPIKey, botRequest.ZenrowAPIKey)
+	err = bot.InitBot(botRequest.SteamProfile, botRequest.SteamAPIKey, fetcher)
 	if err != nil {
 		fmt.Println("error during bot initialization.", err)
 		return
 	}
 
 	populateCookies(bot, botRequest.Cookies)
+	var steamTransport http.RoundTripper
+	if botRequest.SteamHandler != nil {
+		steamTransport = handlerTransport{botRequest.SteamHandler}
+	}
+	bot.setSteamClient(newSteamClient(steamTransport, retry))
+	bot.setSources(sources)
+	bot.setPacing(pacing)
+	bot.setRules(rules)
+	reserveHours := botRequest.ReserveHours
+	if reserveHours <= 0 {
+		reserveHours = defaultReserveHours
+	}
+	bot.setPointsReserve(botRequest.PointsReserve, time.Duration(reserveHours)*time.Hour)
+	err = bot.setScoring(botRequest.Scoring)
+	if err != nil {
+		fmt.Println("invalid scoring configuration.", err)
+		return
+	}
+	if botRequest.TopWishlist != 0 {
+		bot.setTopWishlist(max(botRequest.TopWishlist, 0))
+	}
+	populatePagination(bot, botRequest.MaxPages, botRequest.PagesTimeout)
+	populateSearch(bot, botRequest.SearchBudget, botRequest.SearchBy, botRequest.SearchHours, botRequest.Games)
+	bot.setState(botRequest.State)
+	bot.setFamilySharing(botRequest.FamilySharing)
+	packagesHours := botRequest.PackagesHours
+	if packagesHours <= 0 {
+		packagesHours = defaultPackagesHours
+	}
+	bot.setPackagesTTL(time.Duration(packagesHours) * time.Hour)
+	reconcile := botRequest.ReconcileHours
+	if reconcile == 0 {
+		reconcile = defaultReconcile
+	}
+	bot.setHistory(botRequest.History, time.Duration(max(reconcile, 0))*time.Hour)
 	games := populateGames(botRequest.Games)
 
-	digest, err = runCheck(bot, games)
+	err = bot.checkProfile(ctx)
+	if err != nil {
+		fmt.Println("invalid steam profile.", err)
+		return
+	}
+
+	digest, err = runCheck(ctx, bot, games)
 	if err != nil {
 		fmt.Println("error during check.", err)
 	}
@@ -77,178 +220,219 @@ func RunBot(botRequest *Request) (digest []string, err error) {
 }
 
 // Requirements for execution:
-// Set STEAM_PROFILE environment variable as your steam profile id (https://steamcommunity.com/id/<profile>/)
+// Set STEAM_PROFILE environment variable as your steam profile: 64 bit id, vanity name or profile url (https://steamcommunity.com/id/<profile>/).
+// profile must be public. it's the default account with 'cookies' table, optional if 'accounts' table is filled
+// Other accounts are rows of 'accounts' table (name, profile, steam_key, points_reserve, settings - json with request fields
+// overriding environment settings, like {"sources": [{"type": "wishlist"}], "games": [{"id": 400, "name": "Portal"}]})
+// with cookies in 'account_cookies' table. all accounts are run at once, digest events are marked with account name
 // Set STEAM_API_KEY environment variable for Steam API key (for wishlist downloading)
-// Set ZENROW_KEY environment variable for scraping steamgifts page
+// Set FETCHER environment variable to choose how steamgifts pages are fetched: direct (default) or zenrows
+// Set ZENROW_KEY environment variable for scraping steamgifts page through zenrows (selects zenrows if FETCHER is empty)
+// Set PROXY_URL environment variable (optional) to send direct requests through proxy
+// Set SG_MAX_PAGES environment variable (optional) - how many pages of each listing to walk (default 3, -1 - all)
+// Set SG_PAGES_TIMEOUT environment variable (optional) - seconds to walk one listing (default 20, -1 - no limit)
+// Set SG_SOURCES environment variable (optional) - json list of listings to check (wishlist, all, group, recommended, new, dlc, multiple)
+// with window for giveaways end (default - all) and pages to walk, like [{"type": "wishlist"}, {"type": "all", "window": "1h", "pages": 1}]
+// and bundle policy for package giveaways, like {"type": "all", "bundle": {"min_apps": 2, "min_percent": 50, "primary": true}}
+// Set SG_PACING environment variable (optional) - json with pauses before entries and entries caps, like
+// {"min_delay": "1s", "max_delay": "3s", "per_hour": 20, "per_day": 100, "burst": 3, "burst_window": "10m", "ordered": false}
+// Set SG_RULES_FILE environment variable (optional) - json file with rules for entering giveaways (see rules.go), like
+// [{"title": "cheap followed", "action": "exclude", "lists": ["followed"], "min_points": 16}, {"action": "exclude", "creators": ["X"], "priority": 10}]
+// Set SG_POINTS_RESERVE environment variable (optional) - points which are spent on wishlist giveaways which end soon only
+// Set SG_RESERVE_HOURS environment variable (optional) - wishlist giveaways which end within hours can spend the reserve (default 1)
+// Set SG_SCORING environment variable (optional) - giveaways ranking: priority (win chance per point boosted by wishlist priority, default),
+// chance (win chance per point) or time (first ends - first entered)
+// Set SG_TOP_WISHLIST environment variable (optional) - wishlist games with priority up to it are entered before others (default 10, -1 - none)
+// Set SG_RECONCILE_HOURS environment variable (optional) - check bot entries with steamgifts entered list every hours (default 24, -1 - never)
+// Set SG_FAMILY_SHARING environment variable (optional) - 'true' to skip games shared by steam family members as owned
+// Set SG_PACKAGES_HOURS environment variable (optional) - keep apps of steam packages (subs) resolved for hours (default 168)
+// Set SG_RETRY_ATTEMPTS environment variable (optional) - calls of failed steam or steamgifts request including the first one (default 3, -1 - no retries)
+// Set SG_RETRY_TIMEOUT environment variable (optional) - seconds for all attempts of one request (default 15)
+// Set SG_RUN_TIMEOUT environment variable (optional) - seconds for the bot run since the function start (default 45).
+// The bot also stops 10 seconds before the function deadline to save results
+// Set SG_SEARCH_BUDGET environment variable (optional) - search queries per run for whitelisted games (default 0 - disabled)
+// Set SG_SEARCH_BY environment variable (optional) - search games by 'app' id (default) or 'name'
+// Set SG_SEARCH_HOURS environment variable (optional) - do not search the same game again for hours (default 24)
+// Storage:
+// Set SG_STORAGE environment variable (optional) - where bot data is kept: ydb (default), json or sqlite (bot built with 'sqlite' tag)
+// Set SG_STORAGE_PATH environment variable - directory with json files (see assets/*.example.json) or sqlite database file
 // YDB connection:
 // Set YDB_DATABASE : a name for YDB (shown in yandex cloud console)
 func RunSGBOTFunc(ctx context.Context) (*Response, error) {
-	dbName := os.Getenv("YDB_DATABASE")
-	if len(dbName) == 0 {
-		return nil, fmt.Errorf("no ydb database name")
-	}
-
-	creds := yc.InstanceServiceAccount()
-	token, err := creds.IAMToken(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("can't get iam token. %v", err)
-	}
+	start := time.Now()
 
 	// Determine timeout for connect or do nothing
-	connectCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	dbCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
-	db, err := ycsdk.Open(
-		connectCtx,
-		fmt.Sprintf("grpcs://ydb.serverless.yandexcloud.net:2135/?database=%s", dbName),
-		ycsdk.WithAccessTokenCredentials(token.IamToken),
-	)
+	store, err := openStorage(dbCtx, storageConfig())
 	if err != nil {
-		return nil, fmt.Errorf("ydb connect error: %w", err)
+		return nil, fmt.Errorf("can't open storage. %w", err)
 	}
-	defer func() { _ = db.Close(connectCtx) }()
+	defer func() {
+		closeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), persistTimeout)
+		defer cancel()
+		_ = store.Close(closeCtx)
+	}()
 
-	// get games, cookies from db
-	// make request suited for checking
+	// default settings and account are configured with environment variables
+	// get games, cookies and accounts from storage
+	// make request suited for checking for every account
 	var r Request
 	r.SteamProfile = os.Getenv("STEAM_PROFILE")
 	r.SteamAPIKey = os.Getenv("STEAM_API_KEY")
 	r.ZenrowAPIKey = os.Getenv("ZENROW_KEY")
-
-	err = db.Table().Do(connectCtx, func(ctxSession context.Context, session table.Session) (err error) {
-		txc := table.TxControl(
-			table.BeginTx(table.WithOnlineReadOnly()),
-			table.CommitTx(),
-		)
-
-		// read cookies
-		_, res, err := session.Execute(ctxSession, txc,
-			`--!syntax_v1
-			SELECT name, value, domain, path FROM cookies WHERE domain LIKE "%steam%"
-			`,
-			nil,
-		)
-		if err == nil {
-			for res.NextResultSet(ctxSession) {
-				for res.NextRow() {
-					var c Cookie
-					err := res.ScanNamed(
-						named.OptionalWithDefault("name", &c.Name),
-						named.OptionalWithDefault("value", &c.Value),
-						named.OptionalWithDefault("domain", &c.Domain),
-						named.OptionalWithDefault("path", &c.Path))
-					if err != nil {
-						fmt.Printf("error parsing cookie row. %v", err)
-						continue
-					}
-					r.Cookies = append(r.Cookies, c)
-				}
-			}
-			fmt.Println(len(r.Cookies), "cookies added")
-			res.Close()
-		} else {
-			fmt.Printf("can't select from 'cookie' table. %v", err)
-			return
+	r.Fetcher = os.Getenv("FETCHER")
+	r.ProxyURL = os.Getenv("PROXY_URL")
+	r.MaxPages, _ = strconv.Atoi(os.Getenv("SG_MAX_PAGES"))
+	r.PagesTimeout, _ = strconv.Atoi(os.Getenv("SG_PAGES_TIMEOUT"))
+	r.SearchBudget, _ = strconv.Atoi(os.Getenv("SG_SEARCH_BUDGET"))
+	r.SearchBy = os.Getenv("SG_SEARCH_BY")
+	r.SearchHours, _ = strconv.Atoi(os.Getenv("SG_SEARCH_HOURS"))
+	r.PointsReserve, _ = strconv.Atoi(os.Getenv("SG_POINTS_RESERVE"))
+	r.ReserveHours, _ = strconv.Atoi(os.Getenv("SG_RESERVE_HOURS"))
+	r.Scoring = os.Getenv("SG_SCORING")
+	r.TopWishlist, _ = strconv.Atoi(os.Getenv("SG_TOP_WISHLIST"))
+	r.ReconcileHours, _ = strconv.Atoi(os.Getenv("SG_RECONCILE_HOURS"))
+	r.FamilySharing, _ = strconv.ParseBool(os.Getenv("SG_FAMILY_SHARING"))
+	r.PackagesHours, _ = strconv.Atoi(os.Getenv("SG_PACKAGES_HOURS"))
+	r.RetryAttempts, _ = strconv.Atoi(os.Getenv("SG_RETRY_ATTEMPTS"))
+	r.RetryTimeout, _ = strconv.Atoi(os.Getenv("SG_RETRY_TIMEOUT"))
+	if sources := os.Getenv("SG_SOURCES"); sources != "" {
+		err = json.Unmarshal([]byte(sources), &r.Sources)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse SG_SOURCES. %v", err)
 		}
+	}
+	if rulesFile := os.Getenv("SG_RULES_FILE"); rulesFile != "" {
+		r.Rules, err = loadRules(rulesFile)
+		if err != nil {
+			return nil, fmt.Errorf("can't load SG_RULES_FILE. %v", err)
+		}
+	}
+	if pacing := os.Getenv("SG_PACING"); pacing != "" {
+		err = json.Unmarshal([]byte(pacing), &r.Pacing)
+		if err != nil {
+			return nil, fmt.Errorf("can't parse SG_PACING. %v", err)
+		}
+	}
 
-		// read games
-		_, res, err = session.Execute(ctxSession, txc,
-			`--!syntax_v1
-			SELECT id, name FROM games
-			`,
-			nil,
-		)
-		if err == nil {
-			for res.NextResultSet(ctxSession) {
-				for res.NextRow() {
-					var game Game
-					err := res.ScanNamed(
-						named.OptionalWithDefault("id", &game.Id),
-						named.OptionalWithDefault("name", &game.Name))
-					if err != nil {
-						fmt.Printf("error parsing game row. %v", err)
-						continue
-					}
-					r.Games = append(r.Games, game)
-				}
-			}
-			res.Close()
-			fmt.Println(len(r.Games), "games added")
-		} else {
-			fmt.Printf("can't select from 'game' table. %v", err)
+	r.Games, err = store.Games(dbCtx)
+	if err != nil {
+		fmt.Println("can't read games.", err)
+	}
+	fmt.Println(len(r.Games), "games added")
+
+	accounts, err := store.Accounts(dbCtx)
+	if err != nil {
+		fmt.Println("can't read accounts.", err)
+	}
+	accounts = slices.DeleteFunc(accounts, func(a Account) bool {
+		if a.Name == defaultAccount {
+			fmt.Println("account without name is skipped, default account is set with STEAM_PROFILE")
 		}
-		return
+		return a.Name == defaultAccount
 	})
-	if err != nil {
-		fmt.Println("can't read from db", err)
+	fmt.Println(len(accounts), "accounts added")
+
+	if r.SteamProfile != "" {
+		accounts = append([]Account{{Name: defaultAccount, SteamProfile: r.SteamProfile}}, accounts...)
+	}
+	if len(accounts) == 0 {
+		return nil, fmt.Errorf("no accounts: set STEAM_PROFILE or fill 'accounts' table")
 	}
 
-	fmt.Println("request. profile:", r.SteamProfile)
-	digest, err := RunBot(&r)
+	// read cookies, entries of not ended giveaways and state of every account
+	runs := make([]*AccountRun, 0, len(accounts))
+	for _, account := range accounts {
+		account.Cookies, err = store.Cookies(dbCtx, account.Name, "steam")
+		if err != nil {
+			fmt.Printf("can't read cookies of account '%s'. %v\n", account.Name, err)
+		}
+		fmt.Println(len(account.Cookies), "cookies added for account", account.Name)
 
-	if err != nil {
-		db.Table().Do(connectCtx, func(ctxSession context.Context, session table.Session) (err2 error) {
-			err_record := types.StructValue(types.StructFieldValue("msg", types.UTF8Value(err.Error())),)
-
-			txc := table.TxControl(
-				table.BeginTx(table.WithSerializableReadWrite()),
-				table.CommitTx(),
-			)
-
-			_, _, err2 = session.Execute(ctxSession, txc,
-				`--!syntax_v1
-				DECLARE $messages AS List<Struct<
-					msg: Utf8>>;
-
-				REPLACE INTO digest
-				SELECT msg AS message FROM AS_TABLE($messages);
-				`,
-				table.NewQueryParameters(table.ValueParam("$messages", types.ListValue(err_record))),
-			)
-			if err2 != nil {
-				fmt.Println("can't insert error into 'digest'", err2)
-				return
-			}
-			return
-		})
+		run := &AccountRun{Account: account.Name}
+		run.Request, run.Err = accountRequest(&r, account)
+		runs = append(runs, run)
+		if run.Err != nil {
+			continue
+		}
+
+		entries, err := store.Entries(dbCtx, account.Name, time.Now().Unix())
+		if err != nil {
+			fmt.Printf("can't read entries of account '%s'. %v\n", account.Name, err)
+		} else {
+			run.Request.History = newEntryHistory(entries)
+			fmt.Println(len(entries), "entries added for account", account.Name)
+		}
+
+		raw, err := store.State(dbCtx, accountStateName(account.Name))
+		if err != nil {
+			fmt.Printf("can't read state of account '%s'. %v\n", account.Name, err)
+		}
+		run.Request.State = parseBotState(raw)
+	}
 
-		return nil, fmt.Errorf("bot error: %v", err)
+	// stop the bot in time to persist results (cloud function is limited with 60 seconds)
+	runTimeout, _ := strconv.Atoi(os.Getenv("SG_RUN_TIMEOUT"))
+	if runTimeout <= 0 {
+		runTimeout = defaultRunTimeout
 	}
+	botCtx, cancelBot := context.WithDeadline(ctx, botDeadline(ctx, start, time.Duration(runTimeout)*time.Second))
+	defer cancelBot()
+
+	runAccounts(botCtx, runs)
+
+	// results are saved even if storage reads or the bot took all the time
+	saveCtx, cancelSave := context.WithTimeout(context.WithoutCancel(ctx), persistTimeout)
+	defer cancelSave()
+
+	failed := make([]string, 0)
+	for _, run := range runs {
+		if run.Request != nil {
+			err = store.SaveState(saveCtx, accountStateName(run.Account), run.Request.State.String())
+			if err != nil {
+				fmt.Println("can't update 'state'", err)
+			}
+		}
 
-	if len(digest) > 0 {
-		fmt.Println("update digest")
-		db.Table().Do(connectCtx, func(ctxSession context.Context, session table.Session) (err error) {
-			msgs := make([]types.Value, 0, len(digest))
-			for _, m := range digest {
-				msgs = append(msgs, types.StructValue(
-					types.StructFieldValue("msg", types.UTF8Value(m)),
-				))
+		if run.Request != nil && run.Request.History != nil {
+			err = store.SaveEntries(saveCtx, run.Account, run.Request.History.Changed())
+			if err != nil {
+				fmt.Println("can't update 'entries'", err)
 			}
+		}
+
+		// failed account keeps entries and wins made before the failure (their state is saved already)
+		if run.Err != nil {
+			fmt.Printf("account '%s' failed. %v\n", run.Account, run.Err)
+			failed = append(failed, fmt.Sprintf("'%s': %v", run.Account, run.Err))
+		}
 
-			txc := table.TxControl(
-				table.BeginTx(table.WithSerializableReadWrite()),
-				table.CommitTx(),
-			)
-
-			_, _, err = session.Execute(ctxSession, txc,
-				`--!syntax_v1
-				DECLARE $messages AS List<Struct<
-					msg: Utf8>>;
-
-				REPLACE INTO digest
-				SELECT msg AS message FROM AS_TABLE($messages);
-				`,
-				table.NewQueryParameters(table.ValueParam("$messages", types.ListValue(msgs...))),
-			)
+		if digest := run.Events(); len(digest) > 0 {
+			fmt.Println("update digest of account", run.Account)
+			err = store.AddDigest(saveCtx, digest)
 			if err != nil {
 				fmt.Println("can't insert into 'digest'", err)
-				return
 			}
-			return
-		})
+		}
+	}
+
+	if len(failed) == len(runs) {
+		return nil, fmt.Errorf("bot error: %s", strings.Join(failed, "; "))
 	}
 
 	return &Response{
 		StatusCode: http.StatusOK,
 	}, nil
 }
+
+// botDeadline is the end of the bot run counted from the function start.
+// persistTimeout before the function deadline is kept to save results
+func botDeadline(ctx context.Context, start time.Time, runTimeout time.Duration) time.Time {
+	deadline := start.Add(runTimeout)
+	if fnDeadline, ok := ctx.Deadline(); ok && fnDeadline.Add(-persistTimeout).Before(deadline) {
+		deadline = fnDeadline.Add(-persistTimeout)
+	}
+	return deadline
+}
@@ -1,20 +1,36 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
+// TestBotFunc checks the bot with real accounts. set SGBOT_TEST_PROFILE, SGBOT_TEST_STEAM_KEY, SGBOT_TEST_ZENROW_KEY
+// and SGBOT_TEST_PHPSESSID (copy it from browser after sg login) to run it
 func TestBotFunc(t *testing.T) {
 	req := &Request{}
-	req.SteamProfile = "" // steam profile ID (64 bit number)
-	req.SteamAPIKey = "" // steam API Key
-	req.ZenrowAPIKey = "" // zenrows API key
+	req.SteamProfile = os.Getenv("SGBOT_TEST_PROFILE")    // steam profile ID (64 bit number)
+	req.SteamAPIKey = os.Getenv("SGBOT_TEST_STEAM_KEY")   // steam API Key
+	req.ZenrowAPIKey = os.Getenv("SGBOT_TEST_ZENROW_KEY") // zenrows API key
+	session := os.Getenv("SGBOT_TEST_PHPSESSID")
+	if req.SteamProfile == "" || req.SteamAPIKey == "" || session == "" {
+		t.Skip("no steam profile, steam api key or steamgifts session")
+	}
+
 	req.Cookies = make([]Cookie, 0)
 	req.Cookies = append(req.Cookies,
-		Cookie{Name: "PHPSESSID", Value: "<copy it from browser after sg login>", Domain: "www.steamgifts.com", Path: "/"},
+		Cookie{Name: "PHPSESSID", Value: session, Domain: "www.steamgifts.com", Path: "/"},
 	)
 
-	digest, err := RunBot(req)
+	digest, err := RunBot(context.Background(), req)
 	if err != nil {
 		t.Errorf("error during check: %v", err)
 	}
@@ -23,3 +39,551 @@ func TestBotFunc(t *testing.T) {
 		t.Errorf("no entries")
 	}
 }
+
+// fakeSteamGifts serves steamgifts pages from testdata and accepts entries with ajax.php
+type fakeSteamGifts struct {
+	t       *testing.T
+	points  int
+	costs   map[string]int
+	entered []string
+}
+
+func (f *fakeSteamGifts) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page := "sg_logged_out.html"
+	if c, err := r.Cookie("PHPSESSID"); err == nil && c.Value == "session" {
+		switch {
+		case r.URL.Path == "/ajax.php":
+			f.enter(w, r)
+			return
+		case r.URL.Path == "" || r.URL.Path == "/":
+			page = "sg_main.html"
+		case r.URL.Path == "/giveaways/search" && r.URL.Query().Get("type") == "wishlist":
+			page = "sg_wishlist_1.html"
+			if r.URL.Query().Get("page") == "2" {
+				page = "sg_wishlist_2.html"
+			}
+		case r.URL.Path == "/giveaways/won":
+			page = "sg_won.html"
+		case r.URL.Path == "/giveaways/entered":
+			page = "sg_entered.html"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "text/html")
+	w.Write(loadFixture(f.t, page, time.Now(), f.points))
+}
+
+func (f *fakeSteamGifts) enter(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.PostFormValue("xsrf_token") != "0123456789abcdef0123456789abcdef" || r.PostFormValue("do") != "entry_insert" {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+
+	code := r.PostFormValue("code")
+	cost, ok := f.costs[code]
+	switch {
+	case !ok:
+		fmt.Fprint(w, `{"type":"error","msg":"Giveaway not found"}`)
+	case cost > f.points:
+		fmt.Fprint(w, `{"type":"error","msg":"Not Enough Points"}`)
+	default:
+		f.points -= cost
+		f.entered = append(f.entered, code)
+		fmt.Fprintf(w, `{"type":"success","entry_count":"%d","points":"%d"}`, len(f.entered), f.points)
+	}
+}
+
+// noPauses - entries pacing for fast tests
+var noPauses = &Pacing{MinDelay: "0s", MaxDelay: "0s"}
+
+// offlineRequest builds request served by fake steamgifts and steam with logged in session.
+// override changes defaults for the test
+func offlineRequest(t *testing.T, handler http.Handler, override func(r *Request)) *Request {
+	req := &Request{
+		SteamProfile:   "76561190000000000",
+		SteamAPIKey:    "key",
+		Fetcher:        fetcherMemory,
+		FetcherHandler: handler,
+		SteamHandler:   fakeSteam(t),
+		Pacing:         noPauses,
+		Cookies:        []Cookie{{Name: "PHPSESSID", Value: "session", Domain: "www.steamgifts.com", Path: "/"}},
+	}
+	if override != nil {
+		override(req)
+	}
+	return req
+}
+
+func TestRunBotOffline(t *testing.T) {
+	sg := &fakeSteamGifts{
+		t:      t,
+		points: 120,
+		costs:  map[string]int{"aAaA1": 10, "bBbB2": 5, "cCcC3": 20, "dDdD4": 25, "eEeE5": 50, "fFfF6": 2, "gGgG7": 15},
+	}
+
+	req := offlineRequest(t, sg, func(r *Request) {
+		r.State = newBotState()
+		r.History = newEntryHistory(nil)
+	})
+
+	digest, err := RunBot(context.Background(), req)
+	if err != nil {
+		t.Fatalf("error during check: %v", err)
+	}
+
+	// wishlist: alpha (100), delta bundle (400 followed); epsilon (600) is on the second page.
+	// beta is entered already, gamma isn't whitelisted, eta (800 followed) ends out of main page window
+	want := []string{"aAaA1", "dDdD4", "eEeE5"}
+	got := slices.Sorted(slices.Values(sg.entered))
+	if !slices.Equal(got, want) {
+		t.Errorf("entered %v, want %v", got, want)
+	}
+
+	if len(digest) != len(want) {
+		t.Errorf("digest %+v, want %d events", digest, len(want))
+	}
+	for _, e := range digest {
+		if e.Kind != eventEntry || e.Payload["source"] != "wishlist" || !strings.Contains(e.Text, "[wishlist] Apply for") {
+			t.Errorf("unexpected digest event %+v", e)
+		}
+	}
+
+	changed := req.History.Changed()
+	if len(changed) != len(want) {
+		t.Errorf("history %+v, want %d entries", changed, len(want))
+	}
+	for _, e := range changed {
+		if e.Result != entryEntered {
+			t.Errorf("unexpected entry result %+v", e)
+		}
+	}
+
+	if len(req.State.Recent) != len(want) {
+		t.Errorf("recent entries %v, want %d", req.State.Recent, len(want))
+	}
+
+	if req.State.Wins == nil || req.State.Reconciled == 0 {
+		t.Errorf("wins and entries aren't checked: %+v", req.State)
+	}
+}
+
+func TestRunBotSourceFailed(t *testing.T) {
+	sg := &fakeSteamGifts{t: t, points: 120, costs: map[string]int{"aAaA1": 10, "dDdD4": 25, "eEeE5": 50}}
+	req := offlineRequest(t, sg, func(r *Request) {
+		r.Sources = []Source{{Type: sourceWishlist}, {Type: sourceGroup}}
+	})
+
+	// group listing isn't served
+	digest, err := RunBot(context.Background(), req)
+	if err != nil {
+		t.Fatalf("error during check: %v", err)
+	}
+	if len(sg.entered) != 3 || len(digest) != 4 {
+		t.Errorf("entered %v, digest %+v", sg.entered, digest)
+	}
+	failed := slices.IndexFunc(digest, func(e DigestEvent) bool { return e.Kind == eventError })
+	if failed < 0 || digest[failed].Payload["source"] != sourceGroup {
+		t.Errorf("failed source isn't reported %+v", digest)
+	}
+}
+
+func TestRunBotLoggedOut(t *testing.T) {
+	sg := &fakeSteamGifts{t: t, points: 120}
+	req := offlineRequest(t, sg, func(r *Request) { r.Cookies = nil })
+
+	_, err := RunBot(context.Background(), req)
+	if err == nil {
+		t.Errorf("expected error for expired session")
+	}
+	if len(sg.entered) != 0 {
+		t.Errorf("unexpected entries %v", sg.entered)
+	}
+}
+
+func TestRunBotDeadline(t *testing.T) {
+	sg := &fakeSteamGifts{t: t, points: 120, costs: map[string]int{"aAaA1": 10, "dDdD4": 25, "eEeE5": 50}}
+	req := offlineRequest(t, sg, nil)
+
+	// less than finishTimeReserve - pages are checked, but there is no time for entries
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeReserve/2)
+	defer cancel()
+
+	digest, err := RunBot(ctx, req)
+	if err != nil {
+		t.Fatalf("error during check: %v", err)
+	}
+	if len(sg.entered) != 0 || len(digest) != 0 {
+		t.Errorf("unexpected entries %v, digest %+v", sg.entered, digest)
+	}
+}
+
+func TestRunBotDeadlineSources(t *testing.T) {
+	sg := &fakeSteamGifts{t: t, points: 120, costs: map[string]int{"aAaA1": 10, "dDdD4": 25, "eEeE5": 50}}
+	groupFetched := false
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("type") {
+		case sourceWishlist:
+			// the first source eats the time left for the run
+			time.Sleep(time.Second)
+		case sourceGroup:
+			groupFetched = true
+			<-r.Context().Done()
+			return
+		}
+		sg.ServeHTTP(w, r)
+	})
+	req := offlineRequest(t, handler, func(r *Request) {
+		r.Sources = []Source{{Type: sourceWishlist, Pages: 1}, {Type: sourceGroup}}
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), finishTimeReserve+500*time.Millisecond)
+	defer cancel()
+
+	_, err := RunBot(ctx, req)
+	if err != nil {
+		t.Fatalf("error during check: %v", err)
+	}
+	if groupFetched || len(sg.entered) != 0 {
+		t.Errorf("source is checked after deadline: group %v, entered %v", groupFetched, sg.entered)
+	}
+}
+
+func TestRunBotEntriesCap(t *testing.T) {
+	sg := &fakeSteamGifts{t: t, points: 120, costs: map[string]int{"aAaA1": 10, "dDdD4": 25, "eEeE5": 50}}
+	state := newBotState()
+	state.Recent = []int64{time.Now().Add(-30 * time.Minute).Unix(), time.Now().Add(-25 * time.Hour).Unix()}
+	req := offlineRequest(t, sg, func(r *Request) {
+		r.Pacing = &Pacing{MinDelay: "0s", MaxDelay: "0s", PerHour: 2}
+		r.State = state
+	})
+
+	_, err := RunBot(context.Background(), req)
+	if err != nil {
+		t.Fatalf("error during check: %v", err)
+	}
+
+	// one entry of the last hour is in state already, the day old one is dropped
+	if len(sg.entered) != 1 || len(state.Recent) != 2 {
+		t.Errorf("entered %v, recent %v", sg.entered, state.Recent)
+	}
+}
+
+func TestBotDeadline(t *testing.T) {
+	start := time.Now()
+	if got := botDeadline(context.Background(), start, 45*time.Second); !got.Equal(start.Add(45 * time.Second)) {
+		t.Errorf("deadline without function timeout %v", got.Sub(start))
+	}
+
+	// function deadline leaves less time than SG_RUN_TIMEOUT
+	ctx, cancel := context.WithDeadline(context.Background(), start.Add(30*time.Second))
+	defer cancel()
+	if got := botDeadline(ctx, start, 45*time.Second); !got.Equal(start.Add(30*time.Second - persistTimeout)) {
+		t.Errorf("deadline doesn't keep time to persist %v", got.Sub(start))
+	}
+	if got := botDeadline(ctx, start, 5*time.Second); !got.Equal(start.Add(5 * time.Second)) {
+		t.Errorf("deadline of short run %v", got.Sub(start))
+	}
+}
+
+func TestAccountRequest(t *testing.T) {
+	base := &Request{
+		SteamProfile:  "76561190000000000",
+		SteamAPIKey:   "key",
+		PointsReserve: 50,
+		Sources:       []Source{{Type: "wishlist"}, {Type: "all", Window: "1h"}},
+		Games:         []Game{{Id: 100, Name: "alpha"}},
+		Cookies:       []Cookie{{Name: "PHPSESSID", Value: "default"}},
+		State:         newBotState(),
+	}
+
+	r, err := accountRequest(base, Account{
+		Name:         "second",
+		SteamProfile: "76561190000000001",
+		Settings:     `{"sources": [{"type": "wishlist"}], "games": [{"id": 200, "name": "beta"}], "search_budget": 5}`,
+		Cookies:      []Cookie{{Name: "PHPSESSID", Value: "second"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if r.SteamProfile != "76561190000000001" || r.SteamAPIKey != "key" || r.PointsReserve != 50 || r.SearchBudget != 5 {
+		t.Errorf("unexpected request %+v", r)
+	}
+	if len(r.Sources) != 1 || len(r.Games) != 2 || r.Cookies[0].Value != "second" || r.State != nil {
+		t.Errorf("unexpected sources %v, games %v, cookies %v, state %v", r.Sources, r.Games, r.Cookies, r.State)
+	}
+	if len(base.Sources) != 2 || len(base.Games) != 1 {
+		t.Errorf("default request is changed %+v", base)
+	}
+
+	_, err = accountRequest(base, Account{Name: "broken", Settings: "{"})
+	if err == nil {
+		t.Errorf("expected error for invalid settings")
+	}
+}
+
+func TestRunAccounts(t *testing.T) {
+	costs := map[string]int{"aAaA1": 10, "dDdD4": 25, "eEeE5": 50}
+	first := &fakeSteamGifts{t: t, points: 120, costs: costs}
+	second := &fakeSteamGifts{t: t, points: 120, costs: costs}
+
+	base := &Request{
+		SteamAPIKey:  "key",
+		Fetcher:      fetcherMemory,
+		SteamHandler: fakeSteam(t),
+		Pacing:       noPauses,
+	}
+	session := []Cookie{{Name: "PHPSESSID", Value: "session", Domain: "www.steamgifts.com", Path: "/"}}
+
+	runs := make([]*AccountRun, 0)
+	for _, account := range []Account{
+		{Name: defaultAccount, SteamProfile: "76561190000000000", Cookies: session},
+		{Name: "second", SteamProfile: "76561190000000000"}, // logged out
+	} {
+		run := &AccountRun{Account: account.Name}
+		run.Request, run.Err = accountRequest(base, account)
+		if run.Err != nil {
+			t.Fatal(run.Err)
+		}
+		run.Request.State = newBotState()
+		run.Request.History = newEntryHistory(nil)
+		runs = append(runs, run)
+	}
+	runs[0].Request.FetcherHandler = first
+	runs[1].Request.FetcherHandler = second
+
+	runAccounts(context.Background(), runs)
+
+	if runs[0].Err != nil || len(first.entered) != 3 || len(runs[0].Digest) != 3 {
+		t.Errorf("default account: err %v, entered %v, digest %+v", runs[0].Err, first.entered, runs[0].Digest)
+	}
+	if runs[1].Err == nil || len(second.entered) != 0 || len(runs[1].Request.History.Changed()) != 0 {
+		t.Errorf("logged out account: err %v, entered %v", runs[1].Err, second.entered)
+	}
+
+	// failed run reports events made before the failure too
+	failed := &AccountRun{Account: "second", Digest: []DigestEvent{newEvent(eventWin, nil, "won")},
+		Err: &BotError{When: time.Now(), What: "no user information", Err: ErrAuthExpired}}
+	events := failed.Events()
+	if len(events) != 2 || events[0].Kind != eventWin || events[1].Kind != eventAuthExpired || events[1].Account != "second" {
+		t.Errorf("events of failed run %+v", events)
+	}
+
+	digest := accountEvents("second", []DigestEvent{newEvent(eventError, nil, "line")})
+	if digest[0].Account != "second" || digest[0].Source != sourceSGBot || runs[0].Digest[0].Account != defaultAccount {
+		t.Errorf("unexpected digest %+v", digest)
+	}
+	if accountStateName(defaultAccount) != stateName || accountStateName("second") == stateName {
+		t.Errorf("accounts share state")
+	}
+}
+
+// checkStorage runs the same scenario for every storage implementation
+func checkStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	latest := migrations[len(migrations)-1].Version
+
+	// dry run changes nothing
+	pending, err := migrate(ctx, s, true)
+	if version, _ := s.SchemaVersion(ctx); err != nil || len(pending) == 0 || version != 0 {
+		t.Fatalf("dry run: pending %q, version %d, %v", pending, version, err)
+	}
+	if pending, err = migrate(ctx, s, true); err != nil || len(pending) == 0 {
+		t.Fatalf("dry run is repeated: pending %q, %v", pending, err)
+	}
+
+	if _, err = migrate(ctx, s, false); err != nil {
+		t.Fatal(err)
+	}
+	if version, err := s.SchemaVersion(ctx); err != nil || version != latest {
+		t.Errorf("schema version %d, want %d, %v", version, latest, err)
+	}
+	if pending, err = migrate(ctx, s, true); err != nil || len(pending) != 0 {
+		t.Errorf("migrations are applied already: pending %q, %v", pending, err)
+	}
+
+	entries := []Entry{
+		{SGID: "aAaA1", GID: 100, Points: 10, Time: 100, Ends: 2000, Result: entryEntered},
+		{SGID: "bBbB2", GID: 200, Points: 5, Time: 100, Ends: 1000, Result: entryFailed},
+	}
+	if err := s.SaveEntries(ctx, defaultAccount, entries); err != nil {
+		t.Fatal(err)
+	}
+	entries[1].Result = entryEntered
+	if err := s.SaveEntries(ctx, defaultAccount, entries[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveEntries(ctx, "second", entries[:1]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Entries(ctx, defaultAccount, 500)
+	if err != nil || len(got) != 2 {
+		t.Errorf("entries %+v, %v", got, err)
+	}
+	for _, e := range got {
+		if e.Result != entryEntered {
+			t.Errorf("entry isn't updated %+v", e)
+		}
+	}
+	got, err = s.Entries(ctx, "second", 1500)
+	if err != nil || len(got) != 1 || got[0] != entries[0] {
+		t.Errorf("entries of second account %+v, %v", got, err)
+	}
+
+	if state, err := s.State(ctx, stateName); err != nil || state != "" {
+		t.Errorf("unexpected state %q, %v", state, err)
+	}
+	for _, value := range []string{`{"reconciled":1}`, `{"reconciled":2}`} {
+		if err := s.SaveState(ctx, stateName, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if state, err := s.State(ctx, stateName); err != nil || state != `{"reconciled":2}` {
+		t.Errorf("unexpected state %q, %v", state, err)
+	}
+
+	// identical texts are different events
+	added := []DigestEvent{
+		newEvent(eventEntry, map[string]any{"sgid": "aAaA1"}, "[wishlist] Apply for 100 : alpha"),
+		newEvent(eventError, nil, "can't enter"),
+		newEvent(eventError, nil, "can't enter"),
+	}
+	if err := s.AddDigest(ctx, added[:1]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddDigest(ctx, accountEvents("second", added[1:])); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Unix()
+	digest, err := s.ClaimDigest(ctx, "first", now)
+	if err != nil || len(digest) != len(added) {
+		t.Errorf("digest %+v, %v", digest, err)
+	}
+	for _, e := range digest {
+		i := slices.IndexFunc(added, func(a DigestEvent) bool { return a.ID == e.ID })
+		if i < 0 || e.Time != added[i].Time || e.Source != sourceSGBot || e.Account != added[i].Account || e.Kind != added[i].Kind ||
+			e.Text != added[i].Text || e.Payload["sgid"] != added[i].Payload["sgid"] {
+			t.Errorf("unexpected digest event %+v", e)
+		}
+	}
+
+	// claimed events aren't delivered twice, events added meanwhile are the next digest
+	later := newEvent(eventWin, nil, "won")
+	if err := s.AddDigest(ctx, []DigestEvent{later}); err != nil {
+		t.Fatal(err)
+	}
+	if digest, err = s.ClaimDigest(ctx, "second", now); err != nil || len(digest) != 1 || digest[0].ID != later.ID {
+		t.Errorf("digest of second claim %+v, %v", digest, err)
+	}
+
+	// failed delivery is released, stuck one expires
+	if err := s.ReleaseDigest(ctx, "second"); err != nil {
+		t.Fatal(err)
+	}
+	if digest, err = s.ClaimDigest(ctx, "retry", now); err != nil || len(digest) != 1 || digest[0].ID != later.ID {
+		t.Errorf("released digest %+v, %v", digest, err)
+	}
+	expired := now + int64(digestClaimTimeout.Seconds()) + 1
+	if digest, err = s.ClaimDigest(ctx, "expired", expired); err != nil || len(digest) != len(added)+1 {
+		t.Errorf("expired claims %+v, %v", digest, err)
+	}
+
+	if err := s.MarkDigestSent(ctx, "first", expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.MarkDigestSent(ctx, "expired", expired); err != nil {
+		t.Fatal(err)
+	}
+	if digest, err = s.ClaimDigest(ctx, "sent", expired+int64(digestClaimTimeout.Seconds())+1); err != nil || len(digest) != 0 {
+		t.Errorf("sent digest is claimed again %+v, %v", digest, err)
+	}
+}
+
+func TestJSONStorage(t *testing.T) {
+	dir := t.TempDir()
+	s, err := openStorage(context.Background(), StorageConfig{Kind: storageJSON, Path: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStorage(t, s)
+
+	// files like assets/*.example.json
+	files := map[string]string{
+		jsonGamesFile:    `{"16450": "F.E.A.R. 2: Project Origin", "224060": "Deadpool"}`,
+		jsonCookiesFile:  `{"PHPSESSID": "session:www.steamgifts.com:/", "gog-al": "value:gog.com:/"}`,
+		jsonAccountsFile: `[{"name": "second", "profile": "76561190000000001", "settings": {"search_budget": 5}, "cookies": {"PHPSESSID": "second:www.steamgifts.com:/"}}]`,
+		jsonDigestFile:   `["message of old version"]`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx := context.Background()
+	games, err := s.Games(ctx)
+	if err != nil || len(games) != 2 || games[0] != (Game{Id: 16450, Name: "F.E.A.R. 2: Project Origin"}) {
+		t.Errorf("games %+v, %v", games, err)
+	}
+
+	cookies, err := s.Cookies(ctx, defaultAccount, "steam")
+	want := Cookie{Name: "PHPSESSID", Value: "session", Domain: "www.steamgifts.com", Path: "/"}
+	if err != nil || len(cookies) != 1 || cookies[0] != want {
+		t.Errorf("cookies %+v, %v", cookies, err)
+	}
+
+	accounts, err := s.Accounts(ctx)
+	if err != nil || len(accounts) != 1 || accounts[0].SteamProfile != "76561190000000001" || accounts[0].Settings != `{"search_budget": 5}` {
+		t.Errorf("accounts %+v, %v", accounts, err)
+	}
+	cookies, err = s.Cookies(ctx, "second", "steam")
+	if err != nil || len(cookies) != 1 || cookies[0].Value != "second" {
+		t.Errorf("cookies of second account %+v, %v", cookies, err)
+	}
+
+	digest, err := s.ClaimDigest(ctx, "old", time.Now().Unix())
+	if err != nil || len(digest) != 1 || digest[0].Kind != eventMessage || digest[0].Text != "message of old version" {
+		t.Errorf("digest of old version %+v, %v", digest, err)
+	}
+
+	if _, err = openStorage(ctx, StorageConfig{Kind: "mongo", Path: dir}); !errors.Is(err, ErrMisconfigured) {
+		t.Errorf("expected misconfiguration, got %v", err)
+	}
+}
+
+func TestRenderDigest(t *testing.T) {
+	at := func(hour int) int64 { return time.Date(2024, 5, 1, hour, 0, 0, 0, time.Local).Unix() }
+	events := []DigestEvent{
+		{Source: sourceGOGBot, Kind: eventWin, Time: at(9), Text: "claimed Deadpool"},
+		{Source: sourceSGBot, Account: "second", Kind: eventEntry, Time: at(8), Text: "apply second"},
+		{Source: sourceSGBot, Kind: eventEntry, Time: at(11), Text: "apply later"},
+		{Source: sourceSGBot, Kind: eventEntry, Time: at(10), Text: "apply"},
+		{Source: sourceSGBot, Kind: eventEntry, Time: at(10), Text: "apply"},
+		{Source: sourceSGBot, Kind: eventWin, Time: at(12), Text: "won"},
+		{Kind: eventMessage, Text: "old message"},
+	}
+
+	want := strings.Join([]string{
+		"== SGBOT ==",
+		"05-01 12:00:00. won",
+		"05-01 10:00:00. apply",
+		"05-01 10:00:00. apply",
+		"05-01 11:00:00. apply later",
+		"",
+		"== SGBOT second ==",
+		"05-01 08:00:00. apply second",
+		"",
+		"== GOGBOT ==",
+		"05-01 09:00:00. claimed Deadpool",
+		"",
+		"== OTHER ==",
+		"old message",
+	}, "\n")
+	if got := renderDigest(events); got != want {
+		t.Errorf("digest\n%s\nwant\n%s", got, want)
+	}
+}
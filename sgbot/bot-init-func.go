@@ -5,75 +5,34 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"path"
+	"strconv"
 	"time"
-
-	yc "github.com/yandex-cloud/go-sdk"
-	ycsdk "github.com/ydb-platform/ydb-go-sdk/v3"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
 )
 
 // Requirements for execution:
+// Set SG_STORAGE, SG_STORAGE_PATH environment variables (optional) - storage to prepare (see RunSGBOTFunc), ydb by default
+// Set SG_MIGRATE_DRY_RUN environment variable (optional) - 'true' to print pending migrations without applying them
 // Set YDB_DATABASE environment variable : a name for YDB (shown in yandex cloud console)
+// Tables are created and changed with migrations (see migrations.go), the function is run after every bot update
 func RunInitBotDB(ctx context.Context) (*Response, error) {
-	dbName := os.Getenv("YDB_DATABASE")
-	if len(dbName) == 0 {
-		return nil, fmt.Errorf("no ydb database name")
-	}
-
-	creds := yc.InstanceServiceAccount()
-	token, err := creds.IAMToken(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("can't get iam token. %v", err)
-	}
-
 	// Determine timeout for connect or do nothing
 	connectCtx, cancel := context.WithTimeout(ctx, time.Minute)
 	defer cancel()
 
-	db, err := ycsdk.Open(
-		connectCtx,
-		fmt.Sprintf("grpcs://ydb.serverless.yandexcloud.net:2135/?database=%s", dbName),
-		ycsdk.WithAccessTokenCredentials(token.IamToken),
-	)
+	store, err := openStorage(connectCtx, storageConfig())
 	if err != nil {
-		return nil, fmt.Errorf("ydb connect error: %w", err)
+		return nil, fmt.Errorf("can't open storage. %w", err)
 	}
-	defer func() { _ = db.Close(connectCtx) }()
-
-	err = db.Table().Do(connectCtx, func(ctxSession context.Context, session table.Session) (err error) {
-		// create games table
-		err = session.CreateTable(ctxSession, path.Join(db.Name(), "games"),
-			options.WithColumn("id", types.Optional(types.TypeUint64)),
-			options.WithColumn("name", types.Optional(types.TypeString)),
-			options.WithPrimaryKeyColumn("id"),
-		)
-		if err != nil {
-			return
-		}
-
-		// create cookies table
-		err = session.CreateTable(ctxSession, path.Join(db.Name(), "cookies"),
-			options.WithColumn("name", types.Optional(types.TypeString)),
-			options.WithColumn("value", types.Optional(types.TypeString)),
-			options.WithColumn("domain", types.Optional(types.TypeString)),
-			options.WithColumn("path", types.Optional(types.TypeString)),
-			options.WithPrimaryKeyColumn("name"),
-		)
-		if err != nil {
-			return
+	defer func() { _ = store.Close(connectCtx) }()
+
+	dryRun, _ := strconv.ParseBool(os.Getenv("SG_MIGRATE_DRY_RUN"))
+	pending, err := migrate(connectCtx, store, dryRun)
+	if dryRun {
+		fmt.Println("pending migrations:")
+		for _, statement := range pending {
+			fmt.Println(statement)
 		}
-
-		// create digest table
-		err = session.CreateTable(ctxSession, path.Join(db.Name(), "digest"),
-			options.WithColumn("message", types.Optional(types.TypeUTF8)),
-			options.WithPrimaryKeyColumn("message"),
-		)
-
-		return
-	})
+	}
 	if err != nil {
 		return nil, fmt.Errorf("can't prepare db. %v", err)
 	}
@@ -7,15 +7,9 @@ import (
 	"net/http"
 	"os"
 	"strconv"
-	"strings"
 	"time"
 
 	gomail "gopkg.in/gomail.v2"
-
-	yc "github.com/yandex-cloud/go-sdk"
-	ycsdk "github.com/ydb-platform/ydb-go-sdk/v3"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table"
-	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
 )
 
 func makeMailer() (*gomail.Dialer, error) {
@@ -34,6 +28,31 @@ func makeMailer() (*gomail.Dialer, error) {
 	return gomail.NewDialer(smtp, port, name, pwd), nil
 }
 
+// sendDigest mails digest of events
+func sendDigest(events []DigestEvent) error {
+	mailer, err := makeMailer()
+	if err != nil {
+		return fmt.Errorf("can't create mailer. %v", err)
+	}
+
+	recipient := os.Getenv("MAILER_RECIPIENT")
+	if recipient == "" {
+		return fmt.Errorf("empty recipient")
+	}
+
+	m := gomail.NewMessage()
+	m.SetHeader("From", os.Getenv("MAILER_AUTH_NAME"))
+	m.SetHeader("To", recipient)
+	m.SetHeader("Subject", os.Getenv("MAILER_SUBJECT"))
+	m.SetBody("text/plain", renderDigest(events))
+
+	err = mailer.DialAndSend(m)
+	if err != nil {
+		return fmt.Errorf("can't send digest. %v", err)
+	}
+	return nil
+}
+
 // Requirements for execution:
 // Set MAILER_SMTP environment variable - smtp server to send from
 // Set MAILER_PORT environment variable - smtp server port
@@ -41,112 +60,51 @@ func makeMailer() (*gomail.Dialer, error) {
 // Set MAILER_AUTH_PWD environment variable - smtp server username password
 // Set MAILER_SUBJECT environment variable - digest subject
 // Set MAILER_RECIPIENT environment variable - digest recipient
+// Set SG_STORAGE, SG_STORAGE_PATH environment variables (optional) - storage with digest (see RunSGBOTFunc), ydb by default
 // YDB connection:
 // Set YDB_DATABASE : a name for YDB (shown in yandex cloud console)
 func SendDigest(ctx context.Context) (*Response, error) {
-	dbName := os.Getenv("YDB_DATABASE")
-	if len(dbName) == 0 {
-		return nil, fmt.Errorf("no ydb database name")
-	}
-
-	creds := yc.InstanceServiceAccount()
-	token, err := creds.IAMToken(ctx)
-	if err != nil {
-		return nil, fmt.Errorf("can't get iam token. %v", err)
-	}
-
 	// Determine timeout for connect or do nothing
 	connectCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	db, err := ycsdk.Open(
-		connectCtx,
-		fmt.Sprintf("grpcs://ydb.serverless.yandexcloud.net:2135/?database=%s", dbName),
-		ycsdk.WithAccessTokenCredentials(token.IamToken),
-	)
+	store, err := openStorage(connectCtx, storageConfig())
 	if err != nil {
-		return nil, fmt.Errorf("ydb connect error: %w", err)
+		return nil, fmt.Errorf("can't open storage. %w", err)
 	}
-	defer func() { _ = db.Close(connectCtx) }()
-
-	// fetch digest messages
-	rows := make([]string, 0)
-	err = db.Table().Do(connectCtx, func(ctxSession context.Context, session table.Session) (err error) {
-		txc := table.TxControl(
-			table.BeginTx(table.WithSerializableReadWrite()),
-			table.CommitTx(),
-		)
-
-		// read messages
-		_, res, err := session.Execute(ctxSession, txc,
-			`--!syntax_v1
-			SELECT message FROM digest
-			`,
-			nil,
-		)
-		if err == nil {
-			for res.NextResultSet(ctxSession) {
-				for res.NextRow() {
-					var msg string
-					err := res.ScanNamed(
-						named.OptionalWithDefault("message", &msg))
-					if err != nil {
-						fmt.Println("error parsing digest row.", err)
-						continue
-					}
-					rows = append(rows, msg)
-				}
-			}
-			res.Close()
-		} else {
-			fmt.Println("can't select from 'digest' table.")
-			return
-		}
-
-		// delete digest entries (do not run digest and bot check in one time - kind of race)
-		_, _, err = session.Execute(ctxSession, txc,
-			`--!syntax_v1
-			DELETE FROM digest
-			`,
-			nil,
-		)
-		if err != nil {
-			fmt.Println("can't delete entries in 'digest'.")
-			return
-		}
+	defer func() { _ = store.Close(connectCtx) }()
 
-		return
-	})
+	// claim digest events for this delivery. events added meanwhile are sent next time
+	claim := newEventID()
+	events, err := store.ClaimDigest(connectCtx, claim, time.Now().Unix())
 	if err != nil {
-		fmt.Println("can't perform operation on db.", err)
+		return nil, fmt.Errorf("can't claim digest. %v", err)
 	}
 
-	if len(rows) == 0 {
+	if len(events) == 0 {
 		fmt.Println("nothing to send. exiting")
 		return &Response{
 			StatusCode: http.StatusOK,
 		}, nil
 	}
 
-	mailer, err := makeMailer()
+	err = sendDigest(events)
 	if err != nil {
-		return nil, fmt.Errorf("can't create mailer. %v", err)
-	}
-
-	recipient := os.Getenv("MAILER_RECIPIENT")
-	if recipient == "" {
-		return nil, fmt.Errorf("empty recipient")
+		// failed delivery is retried next run (claim expires anyway if it can't be released)
+		releaseCtx, cancelRelease := context.WithTimeout(ctx, 5*time.Second)
+		defer cancelRelease()
+		if releaseErr := store.ReleaseDigest(releaseCtx, claim); releaseErr != nil {
+			fmt.Println("can't release digest.", releaseErr)
+		}
+		return nil, err
 	}
 
-	m := gomail.NewMessage()
-	m.SetHeader("From", os.Getenv("MAILER_AUTH_NAME"))
-	m.SetHeader("To", os.Getenv("MAILER_RECIPIENT"))
-	m.SetHeader("Subject", os.Getenv("MAILER_SUBJECT"))
-	m.SetBody("text/plain", strings.Join(rows, "\n"))
-
-	err = mailer.DialAndSend(m)
+	// digest is sent again after claim expiry if it isn't marked
+	sentCtx, cancelSent := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelSent()
+	err = store.MarkDigestSent(sentCtx, claim, time.Now().Unix())
 	if err != nil {
-		return nil, fmt.Errorf("can't send digest. %v", err)
+		fmt.Println("can't mark digest as sent.", err)
 	}
 
 	return &Response{
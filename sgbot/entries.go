@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	entryEntered   string = "entered"
+	entryFailed    string = "failed"
+	entryWithdrawn string = "withdrawn" // entered before, but steamgifts doesn't list it anymore
+
+	sgEnteredURL string = "/giveaways/entered"
+
+	// steamgifts entry time may be a bit earlier than the one recorded by bot
+	reconcileSlack time.Duration = time.Hour
+)
+
+// Entry attempt to enter the giveaway
+type Entry struct {
+	SGID   string `json:"sgid"`
+	GID    uint64 `json:"gid"`
+	Points int    `json:"points"`
+	Time   int64  `json:"time"` // unix time of the attempt
+	Ends   int64  `json:"ends"` // unix time of giveaway end
+	Result string `json:"result"`
+}
+
+// EntryHistory entries made by the bot (only not ended giveaways are interesting)
+type EntryHistory struct {
+	entries map[string]*Entry
+	changed map[string]bool
+}
+
+func newEntryHistory(entries []Entry) *EntryHistory {
+	h := &EntryHistory{
+		entries: make(map[string]*Entry),
+		changed: make(map[string]bool),
+	}
+	for i := range entries {
+		h.entries[entries[i].SGID] = &entries[i]
+	}
+	return h
+}
+
+func (h *EntryHistory) put(e Entry) {
+	h.entries[e.SGID] = &e
+	h.changed[e.SGID] = true
+}
+
+// entered checks the giveaway was entered successfully
+func (h *EntryHistory) entered(sgid string) bool {
+	e, ok := h.entries[sgid]
+	return ok && e.Result == entryEntered
+}
+
+// Changed entries to store
+func (h *EntryHistory) Changed() (out []Entry) {
+	for sgid := range h.changed {
+		out = append(out, *h.entries[sgid])
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Time < out[j].Time })
+	return
+}
+
+// recordEntry stores result of the entry attempt
+func (b *TheBot) recordEntry(game GiveAway, result string) {
+	b.history.put(Entry{
+		SGID:   game.SGID,
+		GID:    game.GID,
+		Points: game.Points,
+		Time:   time.Now().Unix(),
+		Ends:   game.Time.Unix(),
+		Result: result,
+	})
+}
+
+// fetchEnteredCodes walks entered giveaways pages (the latest entries first) back to entries made at since.
+// complete is false if not all entries since were read
+func (b *TheBot) fetchEnteredCodes(ctx context.Context, since int64) (codes map[string]bool, complete bool, err error) {
+	codes = make(map[string]bool)
+	for page := 1; ; page++ {
+		if page > 1 && timeIsOver(ctx) {
+			stdlog.Println("no time left for entered pages. stop")
+			return codes, false, nil
+		}
+
+		doc, err := b.getPageCustom(ctx, sgPageURL(sgEnteredURL, page))
+		if err != nil {
+			if page == 1 {
+				return nil, false, err
+			}
+			errlog.Println("can't fetch entered page", page, err)
+			return codes, false, nil
+		}
+		if _, err = b.getToken(doc); err != nil {
+			return nil, false, err
+		}
+
+		// the last timestamp of row is entry time
+		var last int64
+		doc.Find("div.table__row-outer-wrap").Each(func(_ int, row *goquery.Selection) {
+			parts := strings.Split(row.Find("a.table__column__heading").AttrOr("href", ""), "/")
+			if len(parts) >= 3 {
+				codes[parts[2]] = true
+			}
+			if t, err := strconv.ParseInt(row.Find("[data-timestamp]").Last().AttrOr("data-timestamp", ""), 10, 64); err == nil {
+				last = t
+			}
+		})
+
+		if !hasNextPage(doc, page) || last > 0 && last < since {
+			return codes, true, nil
+		}
+	}
+}
+
+// reconcileEntries fixes history with steamgifts entered giveaways list:
+// listed giveaways are entered, not listed ones (from complete list) were withdrawn
+func (b *TheBot) reconcileEntries(ctx context.Context) error {
+	if b.reconcileInterval <= 0 || time.Since(time.Unix(b.state.Reconciled, 0)) < b.reconcileInterval {
+		return nil
+	}
+
+	// entered list is walked back to the oldest entry of not ended giveaway
+	now := time.Now().Unix()
+	since := int64(0)
+	for _, e := range b.history.entries {
+		if e.Ends >= now && (since == 0 || e.Time < since) {
+			since = e.Time
+		}
+	}
+	if since == 0 {
+		b.state.Reconciled = now
+		return nil
+	}
+
+	codes, complete, err := b.fetchEnteredCodes(ctx, since-int64(reconcileSlack.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	fixed := 0
+	for sgid, e := range b.history.entries {
+		if e.Ends < now {
+			continue
+		}
+
+		fix := *e
+		if codes[sgid] && e.Result != entryEntered {
+			fix.Result = entryEntered
+		} else if complete && !codes[sgid] && e.Result == entryEntered {
+			fix.Result = entryWithdrawn
+		} else {
+			continue
+		}
+
+		stdlog.Printf("reconcile entry %s: %s -> %s", sgid, e.Result, fix.Result)
+		b.history.put(fix)
+		fixed++
+	}
+
+	b.state.Reconciled = now
+	stdlog.Printf("entries reconciled (listed: %d, fixed: %d, complete: %v)", len(codes), fixed, complete)
+	return nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// kinds of bot failures. check them with errors.Is
+var (
+	ErrAuthExpired        = errors.New("authorization expired")
+	ErrRateLimited        = errors.New("rate limited")
+	ErrInsufficientPoints = errors.New("not enough points")
+	ErrLevelTooLow        = errors.New("contributor level is too low")
+	ErrAlreadyEntered     = errors.New("already entered")
+	ErrGiveawayEnded      = errors.New("giveaway ended")
+	ErrRegionRestricted   = errors.New("region restricted")
+	ErrParse              = errors.New("parse failure")
+	ErrUnavailable        = errors.New("upstream unavailable")
+	ErrEntryRejected      = errors.New("entry rejected")
+	ErrMisconfigured      = errors.New("misconfigured")
+)
+
+// ajax.php messages (lower case) and their kinds
+var entryMessages = []struct {
+	msg  string
+	kind error
+}{
+	{"not enough points", ErrInsufficientPoints},
+	{"level", ErrLevelTooLow},
+	{"already", ErrAlreadyEntered},
+	{"ended", ErrGiveawayEnded},
+	{"region", ErrRegionRestricted},
+	{"sign in", ErrAuthExpired},
+	{"log in", ErrAuthExpired},
+}
+
+// statusKind maps http status of steamgifts or steam answer to failure kind. nil - not a failure
+func statusKind(status int) error {
+	switch {
+	case status == http.StatusOK:
+		return nil
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuthExpired
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status >= http.StatusInternalServerError:
+		return ErrUnavailable
+	}
+	return ErrEntryRejected
+}
+
+// pageStatusKind maps http status of page request to failure kind
+func pageStatusKind(status int) error {
+	kind := statusKind(status)
+	if kind == ErrAuthExpired || kind == ErrRateLimited {
+		return kind
+	}
+	return ErrUnavailable
+}
+
+// messageKind maps ajax.php error message to failure kind
+func messageKind(msg string) error {
+	lower := strings.ToLower(msg)
+	for _, m := range entryMessages {
+		if strings.Contains(lower, m.msg) {
+			return m.kind
+		}
+	}
+	return ErrEntryRejected
+}
+
+// fatalEntryError means there is no sense to continue entering giveaways during the run
+func fatalEntryError(err error) bool {
+	return errors.Is(err, ErrAuthExpired) || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrUnavailable)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// bots reporting to digest
+	sourceSGBot  string = "sgbot"
+	sourceGOGBot string = "gogbot"
+
+	// kinds of digest events
+	eventWin         string = "win"
+	eventAuthExpired string = "auth-expired"
+	eventError       string = "error"
+	eventEntry       string = "entry"
+	eventOwned       string = "owned"   // whitelisted game is owned
+	eventMessage     string = "message" // text row of old digest table
+)
+
+// eventOrder kinds order in digest email, unknown kinds are the last
+var eventOrder = []string{eventWin, eventAuthExpired, eventError, eventEntry, eventOwned, eventMessage}
+
+// DigestEvent something to report in digest
+type DigestEvent struct {
+	ID      string         `json:"id"`
+	Time    int64          `json:"time"` // unix time
+	Source  string         `json:"source"`
+	Account string         `json:"account"`
+	Kind    string         `json:"kind"`
+	Payload map[string]any `json:"payload"`
+	Text    string         `json:"text"` // rendered event
+}
+
+func newEventID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func newEvent(kind string, payload map[string]any, text string) DigestEvent {
+	return DigestEvent{
+		ID:      newEventID(),
+		Time:    time.Now().Unix(),
+		Source:  sourceSGBot,
+		Kind:    kind,
+		Payload: payload,
+		Text:    text,
+	}
+}
+
+// PayloadJSON payload to store
+func (e *DigestEvent) PayloadJSON() string {
+	if len(e.Payload) == 0 {
+		return "{}"
+	}
+	raw, err := json.Marshal(e.Payload)
+	if err != nil {
+		return "{}"
+	}
+	return string(raw)
+}
+
+// parsePayload reads stored payload, broken one is dropped
+func parsePayload(raw string) map[string]any {
+	payload := make(map[string]any)
+	if raw != "" {
+		_ = json.Unmarshal([]byte(raw), &payload)
+	}
+	return payload
+}
+
+// accountEvents marks events with account
+func accountEvents(account string, events []DigestEvent) []DigestEvent {
+	for i := range events {
+		events[i].Account = account
+	}
+	return events
+}
+
+// renderDigest composes digest text: section for every bot and account, wins and errors first, then by time
+func renderDigest(events []DigestEvent) string {
+	kindOrder := func(kind string) int {
+		for i, k := range eventOrder {
+			if k == kind {
+				return i
+			}
+		}
+		return len(eventOrder)
+	}
+
+	sorted := make([]DigestEvent, len(events))
+	copy(sorted, events)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Source != b.Source {
+			return a.Source > b.Source // sgbot first
+		}
+		if a.Account != b.Account {
+			return a.Account < b.Account // default account first
+		}
+		if kindOrder(a.Kind) != kindOrder(b.Kind) {
+			return kindOrder(a.Kind) < kindOrder(b.Kind)
+		}
+		if a.Time != b.Time {
+			return a.Time < b.Time
+		}
+		return a.Text < b.Text
+	})
+
+	lines := make([]string, 0, len(sorted)+4)
+	section := ""
+	for _, e := range sorted {
+		title := strings.ToUpper(e.Source)
+		if title == "" {
+			title = "OTHER"
+		}
+		if e.Account != defaultAccount {
+			title += " " + e.Account
+		}
+		if title != section {
+			if section != "" {
+				lines = append(lines, "")
+			}
+			lines = append(lines, fmt.Sprintf("== %s ==", title))
+			section = title
+		}
+
+		if e.Time == 0 {
+			lines = append(lines, e.Text)
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%s. %s", time.Unix(e.Time, 0).Format("01-02 15:04:05"), e.Text))
+	}
+	return strings.Join(lines, "\n")
+}
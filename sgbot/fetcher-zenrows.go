@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	scraperapi "github.com/zenrows/zenrows-go-sdk/service/api"
+)
+
+// zenrowsFetcher fetches pages through zenrows.com (bypass cloudflare protection)
+type zenrowsFetcher struct {
+	client  *scraperapi.Client
+	cookies []*http.Cookie
+}
+
+func newZenrowsFetcher(apiKey string) *zenrowsFetcher {
+	return &zenrowsFetcher{client: scraperapi.NewClient(scraperapi.WithAPIKey(apiKey))}
+}
+
+func (f *zenrowsFetcher) SetCookies(cookies []*http.Cookie) {
+	f.cookies = cookies
+}
+
+func (f *zenrowsFetcher) Get(ctx context.Context, uri string) (*FetchResponse, error) {
+	pageURL, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	params := &scraperapi.RequestParameters{
+		JSRender:        true,
+		WaitForSelector: "body",
+		CustomHeaders:   f.headers(pageURL.Host),
+	}
+
+	resp, err := f.client.Get(ctx, pageURL.String(), params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FetchResponse{StatusCode: resp.StatusCode(), Body: resp.Body()}, nil
+}
+
+func (f *zenrowsFetcher) Post(ctx context.Context, uri string, form url.Values) (*FetchResponse, error) {
+	pageURL, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	origin := pageURL.Scheme + "://" + pageURL.Host
+	params := &scraperapi.RequestParameters{
+		CustomHeaders: f.headers(pageURL.Host),
+	}
+	params.CustomHeaders.Set("Referer", origin)
+	params.CustomHeaders.Set("User-Agent", userAgent)
+	params.CustomHeaders.Set("Origin", origin)
+	params.CustomHeaders.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+
+	resp, err := f.client.Post(ctx, pageURL.String(), params, form.Encode())
+	if err != nil {
+		return nil, err
+	}
+
+	return &FetchResponse{StatusCode: resp.StatusCode(), Body: resp.Body()}, nil
+}
+
+func (f *zenrowsFetcher) headers(host string) http.Header {
+	h := http.Header{}
+	for _, k := range domainCookies(f.cookies, host) {
+		h.Add("Cookie", k.String())
+	}
+	return h
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	fetcherDirect  string = "direct"
+	fetcherZenrows string = "zenrows"
+	fetcherMemory  string = "memory"
+
+	userAgent string = "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:153.0) Gecko/20100101 Firefox/153.0"
+)
+
+// FetchResponse raw answer for fetched page
+type FetchResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Fetcher loads pages for the bot. Cookies are sent only to the domain they were set for
+type Fetcher interface {
+	SetCookies(cookies []*http.Cookie)
+	Get(ctx context.Context, uri string) (*FetchResponse, error)
+	Post(ctx context.Context, uri string, form url.Values) (*FetchResponse, error)
+}
+
+// FetcherConfig selects and tunes fetcher implementation
+type FetcherConfig struct {
+	Kind     string       // direct, zenrows or memory. empty - zenrows if api key is set, direct otherwise
+	APIKey   string       // zenrows api key
+	ProxyURL string       // proxy for direct fetcher
+	Handler  http.Handler // pages source for memory fetcher
+	Retry    RetryPolicy  // retries of failed requests
+}
+
+func newFetcher(cfg FetcherConfig) (Fetcher, error) {
+	fetcher, err := newBaseFetcher(cfg)
+	if err != nil || cfg.Retry.Attempts <= 1 {
+		return fetcher, err
+	}
+	return &retryFetcher{Fetcher: fetcher, policy: cfg.Retry}, nil
+}
+
+func newBaseFetcher(cfg FetcherConfig) (Fetcher, error) {
+	kind := cfg.Kind
+	if kind == "" {
+		kind = fetcherDirect
+		if cfg.APIKey != "" {
+			kind = fetcherZenrows
+		}
+	}
+
+	switch kind {
+	case fetcherDirect:
+		return newDirectFetcher(cfg.ProxyURL)
+	case fetcherZenrows:
+		if cfg.APIKey == "" {
+			return nil, &BotError{When: time.Now(), What: "zenrows fetcher requires api key"}
+		}
+		return newZenrowsFetcher(cfg.APIKey), nil
+	case fetcherMemory:
+		if cfg.Handler == nil {
+			return nil, &BotError{When: time.Now(), What: "memory fetcher requires pages handler"}
+		}
+		return newMemoryFetcher(cfg.Handler), nil
+	}
+
+	return nil, &BotError{When: time.Now(), What: fmt.Sprintf("unknown fetcher '%s'", kind)}
+}
+
+// domainCookies filters cookies which belong to the host
+func domainCookies(cookies []*http.Cookie, host string) (out []*http.Cookie) {
+	for _, k := range cookies {
+		if strings.TrimPrefix(k.Domain, ".") != host {
+			continue
+		}
+
+		out = append(out, k)
+	}
+	return
+}
+
+// newPageRequest prepares request with browser-like headers and cookies for the page domain
+func newPageRequest(ctx context.Context, method string, uri string, form url.Values, cookies []*http.Cookie) (*http.Request, error) {
+	pageURL, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, pageURL.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", userAgent)
+	if method == http.MethodPost {
+		origin := pageURL.Scheme + "://" + pageURL.Host
+		req.Header.Set("Referer", origin)
+		req.Header.Set("Origin", origin)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=UTF-8")
+	}
+
+	for _, k := range domainCookies(cookies, pageURL.Host) {
+		req.AddCookie(k)
+	}
+
+	return req, nil
+}
+
+// directFetcher fetches pages with plain net/http client (optionally through proxy)
+type directFetcher struct {
+	client  *http.Client
+	cookies []*http.Cookie
+}
+
+func newDirectFetcher(proxyURL string) (*directFetcher, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if proxyURL != "" {
+		proxy, err := url.Parse(proxyURL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return &directFetcher{client: &http.Client{Transport: transport}}, nil
+}
+
+func (f *directFetcher) SetCookies(cookies []*http.Cookie) {
+	f.cookies = cookies
+}
+
+func (f *directFetcher) Get(ctx context.Context, uri string) (*FetchResponse, error) {
+	return f.do(ctx, http.MethodGet, uri, nil)
+}
+
+func (f *directFetcher) Post(ctx context.Context, uri string, form url.Values) (*FetchResponse, error) {
+	return f.do(ctx, http.MethodPost, uri, form)
+}
+
+func (f *directFetcher) do(ctx context.Context, method string, uri string, form url.Values) (*FetchResponse, error) {
+	req, err := newPageRequest(ctx, method, uri, form, f.cookies)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read body: %d", resp.StatusCode)
+	}
+
+	return &FetchResponse{StatusCode: resp.StatusCode, Header: resp.Header, Body: answer}, nil
+}
+
+// handlerTransport serves http client requests in-process with http.Handler (fake site, test mux, etc)
+type handlerTransport struct {
+	handler http.Handler
+}
+
+func (t handlerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	w := &handlerResponse{header: make(http.Header)}
+	t.handler.ServeHTTP(w, req)
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", w.code, http.StatusText(w.code)),
+		StatusCode:    w.code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        w.header,
+		Body:          io.NopCloser(&w.body),
+		ContentLength: int64(w.body.Len()),
+		Request:       req,
+	}, nil
+}
+
+// handlerResponse answer of http.Handler for handlerTransport
+type handlerResponse struct {
+	code   int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (w *handlerResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *handlerResponse) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+}
+
+func (w *handlerResponse) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	return w.body.Write(p)
+}
+
+// newMemoryFetcher makes fetcher which gets pages from http.Handler without network
+func newMemoryFetcher(handler http.Handler) *directFetcher {
+	return &directFetcher{client: &http.Client{Transport: handlerTransport{handler}}}
+}
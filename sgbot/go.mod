@@ -4,6 +4,7 @@ go 1.23.1
 
 require (
 	github.com/PuerkitoBio/goquery v1.8.0
+	github.com/mattn/go-sqlite3 v1.14.22
 	github.com/yandex-cloud/go-sdk v0.0.0-20220504074640-ff8f2ace74af
 	github.com/ydb-platform/ydb-go-sdk/v3 v3.25.0
 	gopkg.in/gomail.v2 v2.0.0-20160411212932-81ebce5c23df
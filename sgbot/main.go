@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// local run (laptop, docker) with json or sqlite storage: sgbot [init|check|digest]
+// settings are the same environment variables as for cloud functions
+func main() {
+	commands := map[string]func(ctx context.Context) (*Response, error){
+		"init":   RunInitBotDB,
+		"check":  RunSGBOTFunc,
+		"digest": SendDigest,
+	}
+
+	command := "check"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+	run, ok := commands[command]
+	if !ok {
+		fmt.Fprintln(os.Stderr, "usage: sgbot [init|check|digest]")
+		os.Exit(2)
+	}
+
+	_, err := run(context.Background())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+// step kinds of migrations
+const (
+	stepCreateTable  string = "create_table"  // create table with columns and key
+	stepAddColumn    string = "add_column"    // add columns to existing table
+	stepRebuildTable string = "rebuild_table" // recreate table with columns and key, rows are copied (new columns get value)
+)
+
+// rebuildSuffix - table of rebuild_table step is filled under temporary name
+const rebuildSuffix string = "_rebuild"
+
+// column types of migrations (every storage maps them to own types)
+const (
+	columnText   string = "text"  // Utf8
+	columnBytes  string = "bytes" // String
+	columnUint64 string = "uint64"
+	columnInt64  string = "int64"
+)
+
+// Column of storage table
+type Column struct {
+	Name string
+	Type string
+}
+
+// MigrationStep one schema change. applied step is skipped, so steps are idempotent
+type MigrationStep struct {
+	Kind    string
+	Table   string
+	Columns []Column // columns of new or rebuilt table, added columns
+	Key     []string // primary key of new or rebuilt table
+	Value   string   // value of columns added with rebuild_table
+}
+
+// Migration set of steps applied at once. applied migrations are recorded in schema_version table
+type Migration struct {
+	Version int
+	Title   string
+	Steps   []MigrationStep
+}
+
+// schemaVersionTable keeps applied migrations, it's created with the first one
+var schemaVersionTable = MigrationStep{Kind: stepCreateTable, Table: "schema_version", Key: []string{"version"}, Columns: []Column{
+	{"version", columnInt64}, {"title", columnText}, {"applied", columnInt64}}}
+
+// migrations of bot storage, ordered by version. never change applied migrations - add new ones
+var migrations = []Migration{
+	{
+		Version: 1,
+		Title:   "initial tables",
+		Steps: []MigrationStep{
+			{Kind: stepCreateTable, Table: "games", Key: []string{"id"}, Columns: []Column{
+				{"id", columnUint64}, {"name", columnBytes}}},
+			{Kind: stepCreateTable, Table: "cookies", Key: []string{"name"}, Columns: []Column{
+				{"name", columnBytes}, {"value", columnBytes}, {"domain", columnBytes}, {"path", columnBytes}}},
+			{Kind: stepCreateTable, Table: "digest", Key: []string{"message"}, Columns: []Column{
+				{"message", columnText}}},
+			{Kind: stepCreateTable, Table: "entries", Key: []string{"sgid"}, Columns: []Column{
+				{"sgid", columnText}, {"gid", columnUint64}, {"points", columnInt64},
+				{"time", columnInt64}, {"ends", columnInt64}, {"result", columnText}}},
+			{Kind: stepCreateTable, Table: "state", Key: []string{"name"}, Columns: []Column{
+				{"name", columnText}, {"value", columnText}}},
+		},
+	},
+	{
+		Version: 2,
+		Title:   "accounts",
+		Steps: []MigrationStep{
+			{Kind: stepCreateTable, Table: "accounts", Key: []string{"name"}, Columns: []Column{
+				{"name", columnText}, {"profile", columnText}, {"steam_key", columnText},
+				{"points_reserve", columnInt64}, {"settings", columnText}}},
+			{Kind: stepCreateTable, Table: "account_cookies", Key: []string{"account", "name"}, Columns: []Column{
+				{"account", columnText}, {"name", columnBytes}, {"value", columnBytes}, {"domain", columnBytes}, {"path", columnBytes}}},
+			// entries are kept per account, the existing ones belong to the default account
+			{Kind: stepRebuildTable, Table: "entries", Key: []string{"account", "sgid"}, Value: defaultAccount, Columns: []Column{
+				{"account", columnText}, {"sgid", columnText}, {"gid", columnUint64}, {"points", columnInt64},
+				{"time", columnInt64}, {"ends", columnInt64}, {"result", columnText}}},
+		},
+	},
+	{
+		Version: 3,
+		Title:   "digest events",
+		Steps: []MigrationStep{
+			// rows of old digest table are sent as messages once
+			{Kind: stepCreateTable, Table: "digest_events", Key: []string{"id"}, Columns: []Column{
+				{"id", columnText}, {"time", columnInt64}, {"source", columnText}, {"account", columnText},
+				{"kind", columnText}, {"payload", columnText}, {"text", columnText}}},
+		},
+	},
+	{
+		Version: 4,
+		Title:   "digest delivery",
+		Steps: []MigrationStep{
+			// claim of delivery attempt, unix time of claim and of delivery
+			{Kind: stepAddColumn, Table: "digest_events", Columns: []Column{
+				{"claim", columnText}, {"claimed", columnInt64}, {"sent", columnInt64}}},
+		},
+	},
+}
+
+// Migrator storage side of migrations
+type Migrator interface {
+	// SchemaVersion the latest applied migration, 0 - none
+	SchemaVersion(ctx context.Context) (int, error)
+	// MigrateStep applies the step if it isn't applied yet (nothing is changed with dryRun).
+	// returns statement of the step, empty - step is applied already
+	MigrateStep(ctx context.Context, step MigrationStep, dryRun bool) (string, error)
+	// RecordMigration stores applied migration
+	RecordMigration(ctx context.Context, m Migration) error
+}
+
+// migrate applies pending migrations in order and returns their statements. dryRun only returns statements
+func migrate(ctx context.Context, m Migrator, dryRun bool) (pending []string, err error) {
+	version, err := m.SchemaVersion(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't read schema version. %v", err)
+	}
+	fmt.Println("schema version", version)
+
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+
+		pending = append(pending, fmt.Sprintf("-- migration %d: %s", migration.Version, migration.Title))
+		for _, step := range migration.Steps {
+			statement, err := m.MigrateStep(ctx, step, dryRun)
+			if err != nil {
+				return pending, fmt.Errorf("migration %d '%s' failed on %s %s. %v", migration.Version, migration.Title, step.Kind, step.Table, err)
+			}
+			if statement != "" {
+				pending = append(pending, statement)
+			}
+		}
+
+		if dryRun {
+			continue
+		}
+		err = m.RecordMigration(ctx, migration)
+		if err != nil {
+			return pending, fmt.Errorf("can't record migration %d. %v", migration.Version, err)
+		}
+		fmt.Printf("migration %d '%s' is applied\n", migration.Version, migration.Title)
+	}
+	return pending, nil
+}
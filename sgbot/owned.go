@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	steamOwnedGamesURL  string = "https://api.steampowered.com/IPlayerService/GetOwnedGames/v1/?key=%s&steamid=%s&include_played_free_games=1"
+	steamFamilyGroupURL string = "https://api.steampowered.com/IFamilyGroupsService/GetFamilyGroupForUser/v1/?key=%s&steamid=%s"
+	steamSharedAppsURL  string = "https://api.steampowered.com/IFamilyGroupsService/GetSharedLibraryApps/v1/?key=%s&family_groupid=%s&steamid=%s&include_own=false"
+)
+
+// steamAPIGet loads steam web api answer into response
+func steamAPIGet[T any](ctx context.Context, client *http.Client, url string, response *ApiResponse[T]) error {
+	resp, err := steamGet(ctx, client, url)
+	if err != nil {
+		return fmt.Errorf("failed process request: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: %d: %w", resp.StatusCode, pageStatusKind(resp.StatusCode))
+	}
+
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("can't read body: %d", resp.StatusCode)
+	}
+
+	err = json.Unmarshal(answer, response)
+	if err != nil {
+		return fmt.Errorf("failed unmarshall json response: %v: %w", err, ErrParse)
+	}
+	return nil
+}
+
+// fetchOwnedGames returns apps of steam library
+func fetchOwnedGames(ctx context.Context, client *http.Client, steamID string, apiKey string) (map[uint64]bool, error) {
+	type Games struct {
+		Games []struct {
+			AppID uint64 `json:"appid"`
+		} `json:"games"`
+	}
+
+	games := ApiResponse[Games]{}
+	err := steamAPIGet(ctx, client, fmt.Sprintf(steamOwnedGamesURL, apiKey, steamID), &games)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[uint64]bool)
+	for _, game := range games.Resp.Games {
+		out[game.AppID] = true
+	}
+	return out, nil
+}
+
+// fetchFamilyLibrary returns apps shared with the user by steam family members
+func fetchFamilyLibrary(ctx context.Context, client *http.Client, steamID string, apiKey string) (map[uint64]bool, error) {
+	type Group struct {
+		GroupID string `json:"family_groupid"`
+	}
+
+	group := ApiResponse[Group]{}
+	err := steamAPIGet(ctx, client, fmt.Sprintf(steamFamilyGroupURL, apiKey, steamID), &group)
+	if err != nil {
+		return nil, err
+	}
+	if group.Resp.GroupID == "" || group.Resp.GroupID == "0" {
+		return map[uint64]bool{}, nil
+	}
+
+	type Apps struct {
+		Apps []struct {
+			AppID uint64 `json:"appid"`
+		} `json:"apps"`
+	}
+
+	apps := ApiResponse[Apps]{}
+	err = steamAPIGet(ctx, client, fmt.Sprintf(steamSharedAppsURL, apiKey, group.Resp.GroupID, steamID), &apps)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[uint64]bool)
+	for _, app := range apps.Resp.Apps {
+		out[app.AppID] = true
+	}
+	return out, nil
+}
+
+// excludeOwned removes owned (and family shared) games from whitelist.
+// games owned since the previous check are reported, the first check is silent
+func (b *TheBot) excludeOwned(ctx context.Context) error {
+	owned, err := fetchOwnedGames(ctx, b.steamClient, b.steamID, b.steamAPIKey)
+	if err != nil {
+		return err
+	}
+	stdlog.Println("owned games", len(owned))
+
+	if b.familySharing {
+		shared, err := fetchFamilyLibrary(ctx, b.steamClient, b.steamID, b.steamAPIKey)
+		if err != nil {
+			stdlog.Println("can't fetch family library", err)
+		} else {
+			stdlog.Println("family shared games", len(shared))
+			for gid := range shared {
+				owned[gid] = true
+			}
+		}
+	}
+
+	firstCheck := b.state.Owned == nil
+	excluded := make(map[uint64]int64)
+	for gid := range b.gamesWhitelist {
+		if !owned[gid] {
+			continue
+		}
+
+		name := b.gamesWhitelist[gid].Name
+		delete(b.gamesWhitelist, gid)
+
+		since, ok := b.state.Owned[gid]
+		if !ok {
+			since = time.Now().Unix()
+			if !firstCheck {
+				stdlog.Println("skip game - already owned", gid, name)
+				b.addEvent(eventOwned, map[string]any{"gid": gid, "name": name}, fmt.Sprintf("%d : %s skipped, already owned", gid, name))
+			}
+		}
+		excluded[gid] = since
+	}
+	b.state.Owned = excluded
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	defaultMinDelay    string = "1s"
+	defaultMaxDelay    string = "3s"
+	defaultBurst       int    = 3
+	defaultBurstWindow string = "10m"
+)
+
+// Pacing spreads entries in time like a human does
+type Pacing struct {
+	MinDelay    string `json:"min_delay"`    // pause before every entry is random between min and max delays (like "1s"), empty - default
+	MaxDelay    string `json:"max_delay"`    // (1-3 seconds by default)
+	PerHour     int    `json:"per_hour"`     // entries per hour, 0 - no cap
+	PerDay      int    `json:"per_day"`      // entries per day, 0 - no cap
+	Burst       int    `json:"burst"`        // entries without pause per run for giveaways which end within burst window, 0 - default, < 0 - none
+	BurstWindow string `json:"burst_window"` // (3 giveaways within 10 minutes by default)
+	Ordered     bool   `json:"ordered"`      // giveaways with equal score are entered by end time, not in random order
+
+	minDelay    time.Duration
+	maxDelay    time.Duration
+	burstWindow time.Duration
+}
+
+// parsePacing validates pacing configuration. nil - defaults
+func parsePacing(p *Pacing) (Pacing, error) {
+	out := Pacing{}
+	if p != nil {
+		out = *p
+	}
+
+	durations := []struct {
+		name  string
+		value string
+		def   string
+		out   *time.Duration
+	}{
+		{"min_delay", out.MinDelay, defaultMinDelay, &out.minDelay},
+		{"max_delay", out.MaxDelay, defaultMaxDelay, &out.maxDelay},
+		{"burst_window", out.BurstWindow, defaultBurstWindow, &out.burstWindow},
+	}
+	for _, d := range durations {
+		value := d.value
+		if value == "" {
+			value = d.def
+		}
+
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed < 0 {
+			return Pacing{}, &BotError{When: time.Now(), What: fmt.Sprintf("invalid pacing %s '%s'", d.name, d.value)}
+		}
+		*d.out = parsed
+	}
+
+	if out.maxDelay < out.minDelay {
+		return Pacing{}, &BotError{When: time.Now(), What: fmt.Sprintf("pacing max_delay '%s' is less than min_delay '%s'", out.MaxDelay, out.MinDelay)}
+	}
+
+	if out.Burst == 0 {
+		out.Burst = defaultBurst
+	}
+	out.Burst = max(out.Burst, 0)
+
+	return out, nil
+}
+
+// pacer schedules entries of the run with pacing rules
+type pacer struct {
+	Pacing
+
+	// entries made without pause during the run
+	bursts int
+}
+
+func newPacer(pacing Pacing) *pacer {
+	return &pacer{Pacing: pacing}
+}
+
+// countSince counts entries made after the time
+func countSince(recent []int64, since time.Time) (n int) {
+	for _, t := range recent {
+		if t > since.Unix() {
+			n++
+		}
+	}
+	return
+}
+
+// capped means no more entries are allowed now. recent - unix times of the last day entries
+func (p *pacer) capped(recent []int64, now time.Time) bool {
+	if p.PerHour > 0 && countSince(recent, now.Add(-time.Hour)) >= p.PerHour {
+		return true
+	}
+	return p.PerDay > 0 && countSince(recent, now.Add(-24*time.Hour)) >= p.PerDay
+}
+
+// delay before entering the giveaway. false - giveaway ends before the pause is over
+func (p *pacer) delay(game GiveAway, now time.Time) (time.Duration, bool) {
+	if game.Time.Sub(now) < p.burstWindow && p.bursts < p.Burst {
+		p.bursts++
+		return 0, true
+	}
+
+	d := p.minDelay
+	if p.maxDelay > p.minDelay {
+		d += time.Duration(rand.Int63n(int64(p.maxDelay - p.minDelay)))
+	}
+	return d, game.Time.After(now.Add(d))
+}
+
+// pruneRecent drops entries made more than a day ago
+func pruneRecent(recent []int64, now time.Time) []int64 {
+	out := make([]int64, 0, len(recent))
+	for _, t := range recent {
+		if t > now.Add(-24*time.Hour).Unix() {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// shuffle gives random order to giveaways with equal score (before stable ranking)
+func (p *pacer) shuffle(giveaways []GiveAway) {
+	if p.Ordered {
+		return
+	}
+	rand.Shuffle(len(giveaways), func(i, j int) {
+		giveaways[i], giveaways[j] = giveaways[j], giveaways[i]
+	})
+}
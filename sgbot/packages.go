@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	steamPackageDetailsURL string = "https://store.steampowered.com/api/packagedetails?packageids=%d"
+	steamPackageURL        string = "https://store.steampowered.com/sub/%d/"
+
+	defaultPackagesHours int = 24 * 7
+)
+
+var rePackageID = regexp.MustCompile(`/sub/([0-9]+)`)
+
+// CachedPackage apps of steam package (sub) resolved at the time
+type CachedPackage struct {
+	Apps []uint64 `json:"apps"`
+	Time int64    `json:"time"`
+}
+
+// fetchPackageDetails gets package apps from steam store api
+func fetchPackageDetails(ctx context.Context, client *http.Client, subID uint64) ([]uint64, error) {
+	resp, err := steamGet(ctx, client, fmt.Sprintf(steamPackageDetailsURL, subID))
+	if err != nil {
+		return nil, fmt.Errorf("failed process request: %v", err)
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d: %w", resp.StatusCode, pageStatusKind(resp.StatusCode))
+	}
+
+	answer, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("can't read body: %d", resp.StatusCode)
+	}
+
+	type App struct {
+		ID uint64 `json:"id"`
+	}
+	type Details struct {
+		Success bool `json:"success"`
+		Data    struct {
+			Apps []App `json:"apps"`
+		} `json:"data"`
+	}
+
+	details := map[string]Details{}
+	err = json.Unmarshal(answer, &details)
+	if err != nil {
+		return nil, fmt.Errorf("failed unmarshall json response: %v: %w", err, ErrParse)
+	}
+
+	pkg, ok := details[strconv.FormatUint(subID, 10)]
+	if !ok || !pkg.Success {
+		return nil, fmt.Errorf("no details for package %d: %w", subID, ErrParse)
+	}
+
+	apps := make([]uint64, 0, len(pkg.Data.Apps))
+	for _, app := range pkg.Data.Apps {
+		apps = append(apps, app.ID)
+	}
+	return apps, nil
+}
+
+// scrapePackageApps gets package apps from steam store page
+func scrapePackageApps(ctx context.Context, client *http.Client, subID uint64) ([]uint64, error) {
+	doc, err := fetchSteamPage(ctx, client, fmt.Sprintf(steamPackageURL, subID))
+	if err != nil {
+		return nil, err
+	}
+
+	apps := make([]uint64, 0)
+	for _, id := range doc.Find("div.tab_item").Map(func(_ int, s *goquery.Selection) string {
+		return s.AttrOr("data-ds-appid", "")
+	}) {
+		gid, err := strconv.ParseUint(id, 10, 64)
+		if err == nil {
+			apps = append(apps, gid)
+		}
+	}
+
+	if len(apps) == 0 {
+		return nil, fmt.Errorf("no apps on package %d page: %w", subID, ErrParse)
+	}
+	return apps, nil
+}
+
+// resolvePackage gets apps of the package from store link. results are cached in bot state for packages ttl
+func (b *TheBot) resolvePackage(ctx context.Context, link string) ([]uint64, error) {
+	m := rePackageID.FindStringSubmatch(link)
+	if m == nil {
+		return nil, fmt.Errorf("no package id in %s: %w", link, ErrParse)
+	}
+	subID, _ := strconv.ParseUint(m[1], 10, 64)
+
+	now := time.Now()
+	if cached, ok := b.state.Packages[subID]; ok && now.Sub(time.Unix(cached.Time, 0)) < b.packagesTTL {
+		return cached.Apps, nil
+	}
+
+	apps, err := fetchPackageDetails(ctx, b.steamClient, subID)
+	if err != nil {
+		stdlog.Printf("can't get package %d details (%v), parse store page\n", subID, err)
+		apps, err = scrapePackageApps(ctx, b.steamClient, subID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// drop expired packages to keep state small
+	for id, cached := range b.state.Packages {
+		if now.Sub(time.Unix(cached.Time, 0)) >= b.packagesTTL {
+			delete(b.state.Packages, id)
+		}
+	}
+	b.state.Packages[subID] = &CachedPackage{Apps: apps, Time: now.Unix()}
+
+	return apps, nil
+}
+
+// joinIDs formats app ids list for digest
+func joinIDs(ids []uint64) string {
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		out = append(out, strconv.FormatUint(id, 10))
+	}
+	return strings.Join(out, ", ")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	steamResolveVanityURL   string = "https://api.steampowered.com/ISteamUser/ResolveVanityURL/v1/?key=%s&vanityurl=%s"
+	steamPlayerSummariesURL string = "https://api.steampowered.com/ISteamUser/GetPlayerSummaries/v2/?key=%s&steamids=%s"
+
+	steamProfilePublic int = 3 // communityvisibilitystate of public profile
+)
+
+var (
+	reSteamID        = regexp.MustCompile(`^[0-9]{17}$`)
+	reSteamVanity    = regexp.MustCompile(`^[A-Za-z0-9_-]{2,32}$`)
+	reSteamCommunity = regexp.MustCompile(`steamcommunity\.com/(profiles|id)/([^/?#]+)`)
+)
+
+// parseSteamProfile takes 64 bit steam id, vanity name or profile url (https://steamcommunity.com/id/<name>/ or /profiles/<id>/).
+// returns steam id or vanity name to resolve
+func parseSteamProfile(profile string) (steamID string, vanity string, err error) {
+	profile = strings.TrimSpace(profile)
+	isURL := false
+	if m := reSteamCommunity.FindStringSubmatch(profile); m != nil {
+		if m[1] == "id" {
+			return "", m[2], nil
+		}
+		profile, isURL = m[2], true
+	}
+
+	switch {
+	case reSteamID.MatchString(profile):
+		return profile, "", nil
+	case !isURL && reSteamVanity.MatchString(profile):
+		return "", profile, nil
+	}
+
+	return "", "", &BotError{When: time.Now(), What: fmt.Sprintf("invalid steam profile '%s': expected steam id, vanity name or profile url", profile), Err: ErrMisconfigured}
+}
+
+// checkProfile resolves vanity name to steam id and checks api key and profile visibility
+func (b *TheBot) checkProfile(ctx context.Context) error {
+	misconfigured := func(what string) error {
+		return &BotError{When: time.Now(), What: what, Err: ErrMisconfigured}
+	}
+
+	if b.steamVanity != "" {
+		type Vanity struct {
+			SteamID string `json:"steamid"`
+			Success int    `json:"success"`
+		}
+
+		vanity := ApiResponse[Vanity]{}
+		err := steamAPIGet(ctx, b.steamClient, fmt.Sprintf(steamResolveVanityURL, b.steamAPIKey, url.QueryEscape(b.steamVanity)), &vanity)
+		if errors.Is(err, ErrAuthExpired) {
+			return misconfigured("steam api key is invalid")
+		}
+		if err != nil {
+			return err
+		}
+		if vanity.Resp.Success != 1 || !reSteamID.MatchString(vanity.Resp.SteamID) {
+			return misconfigured(fmt.Sprintf("no steam profile '%s'", b.steamVanity))
+		}
+
+		stdlog.Printf("steam profile '%s' is resolved to %s\n", b.steamVanity, vanity.Resp.SteamID)
+		b.steamID = vanity.Resp.SteamID
+		b.steamVanity = ""
+	}
+
+	type Players struct {
+		Players []struct {
+			SteamID    string `json:"steamid"`
+			Name       string `json:"personaname"`
+			Visibility int    `json:"communityvisibilitystate"`
+		} `json:"players"`
+	}
+
+	players := ApiResponse[Players]{}
+	err := steamAPIGet(ctx, b.steamClient, fmt.Sprintf(steamPlayerSummariesURL, b.steamAPIKey, b.steamID), &players)
+	if errors.Is(err, ErrAuthExpired) {
+		return misconfigured("steam api key is invalid")
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(players.Resp.Players) == 0 {
+		return misconfigured(fmt.Sprintf("no steam profile %s", b.steamID))
+	}
+	if player := players.Resp.Players[0]; player.Visibility != steamProfilePublic {
+		return misconfigured(fmt.Sprintf("steam profile %s (%s) is not public, wishlist and games can't be read", b.steamID, player.Name))
+	}
+
+	return nil
+}
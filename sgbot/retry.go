@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultRetryAttempts int = 3
+	defaultRetryTimeout  int = 15 // seconds
+)
+
+// RetryPolicy limits retries of outbound calls (steam api, steam store, steamgifts)
+type RetryPolicy struct {
+	Attempts  int           // calls including the first one, <= 1 - no retries
+	BaseDelay time.Duration // delay before the first retry, doubled for every next one (with jitter)
+	MaxDelay  time.Duration // the longest delay. Retry-After above it stops retries
+	MaxTotal  time.Duration // time for all attempts, 0 - no limit
+}
+
+func defaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		Attempts:  defaultRetryAttempts,
+		BaseDelay: 500 * time.Millisecond,
+		MaxDelay:  5 * time.Second,
+		MaxTotal:  time.Duration(defaultRetryTimeout) * time.Second,
+	}
+}
+
+// retryableStatus - answers which are worth to repeat the same request for
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// notSent means request failed on connection and never reached the server (safe to repeat any request)
+func notSent(err error) bool {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return true
+	}
+
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "proxyconnect")
+}
+
+// retryAfter parses Retry-After header (seconds or http date), 0 - no header
+func retryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(max(seconds, 0)) * time.Second
+	}
+
+	if when, err := http.ParseTime(value); err == nil {
+		return max(time.Until(when), 0)
+	}
+	return 0
+}
+
+// delay before retry after the attempt: jittered exponential backoff or Retry-After if server asks for longer
+func (p RetryPolicy) delay(attempt int, status int, header http.Header) (time.Duration, bool) {
+	backoff := p.BaseDelay << (attempt - 1)
+	if backoff > p.MaxDelay || backoff < 0 {
+		backoff = p.MaxDelay
+	}
+	if backoff > 0 {
+		backoff = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+	}
+
+	if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+		wait := retryAfter(header)
+		if wait > p.MaxDelay {
+			return 0, false
+		}
+		backoff = max(backoff, wait)
+	}
+
+	return backoff, true
+}
+
+// do calls the request until it succeeds, fails for good or policy limits are reached.
+// not idempotent request is repeated only if it wasn't sent. returns error of the last call
+func (p RetryPolicy) do(ctx context.Context, idempotent bool, call func() (status int, header http.Header, err error)) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		status, header, err := call()
+
+		retry := idempotent && retryableStatus(status)
+		if err != nil {
+			retry = (idempotent || notSent(err)) && ctx.Err() == nil
+		}
+		if !retry || attempt >= p.Attempts {
+			return err
+		}
+
+		wait, ok := p.delay(attempt, status, header)
+		if !ok {
+			stdlog.Printf("retry-after for status %d is too long. give up\n", status)
+			return err
+		}
+		if p.MaxTotal > 0 && time.Since(start)+wait > p.MaxTotal {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		stdlog.Printf("attempt %d failed (status %d, error %v). retry in %v\n", attempt, status, err, wait)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// retryTransport repeats http client requests with the policy. GET and HEAD are idempotent
+type retryTransport struct {
+	base   http.RoundTripper
+	policy RetryPolicy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	idempotent := req.Method == http.MethodGet || req.Method == http.MethodHead
+	err = t.policy.do(req.Context(), idempotent, func() (int, http.Header, error) {
+		if resp != nil {
+			resp.Body.Close()
+			resp = nil
+		}
+
+		attempt := req
+		if req.Body != nil && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return 0, nil, err
+			}
+			attempt = req.Clone(req.Context())
+			attempt.Body = body
+		}
+
+		resp, err = t.base.RoundTrip(attempt)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode, resp.Header, nil
+	})
+	return
+}
+
+// newSteamClient makes client for steam api and store pages with retries. nil transport - network
+func newSteamClient(transport http.RoundTripper, policy RetryPolicy) *http.Client {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &http.Client{Timeout: steamTimeout, Transport: &retryTransport{base: transport, policy: policy}}
+}
+
+// retryFetcher repeats page requests with the policy. entries (POST) are repeated only if they weren't sent
+type retryFetcher struct {
+	Fetcher
+	policy RetryPolicy
+}
+
+func (f *retryFetcher) Get(ctx context.Context, uri string) (resp *FetchResponse, err error) {
+	err = f.policy.do(ctx, true, func() (int, http.Header, error) {
+		resp, err = f.Fetcher.Get(ctx, uri)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode, resp.Header, nil
+	})
+	return
+}
+
+func (f *retryFetcher) Post(ctx context.Context, uri string, form url.Values) (resp *FetchResponse, err error) {
+	err = f.policy.do(ctx, false, func() (int, http.Header, error) {
+		resp, err = f.Fetcher.Post(ctx, uri, form)
+		if err != nil {
+			return 0, nil, err
+		}
+		return resp.StatusCode, resp.Header, nil
+	})
+	return
+}
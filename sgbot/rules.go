@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"time"
+)
+
+const (
+	ruleInclude string = "include"
+	ruleExclude string = "exclude"
+)
+
+// Rule decides if giveaway is entered. all set conditions must match the giveaway
+type Rule struct {
+	Title    string `json:"title"`    // rule name for logs
+	Action   string `json:"action"`   // include or exclude
+	Priority int    `json:"priority"` // rules with higher priority are checked first, the first matched rule decides
+
+	Apps       []uint64 `json:"apps"`        // steam app ids
+	Name       string   `json:"name"`        // giveaway name regexp (case insensitive)
+	Lists      []string `json:"lists"`       // game is in one of lists: wishlist, followed or manual
+	Sources    []string `json:"sources"`     // giveaway is found in one of sources (wishlist, all, ..., search)
+	Creators   []string `json:"creators"`    // giveaway creators
+	MinPoints  *int     `json:"min_points"`  // cost
+	MaxPoints  *int     `json:"max_points"`  //
+	MinCopies  *int     `json:"min_copies"`  //
+	MaxCopies  *int     `json:"max_copies"`  //
+	MinEntries *int     `json:"min_entries"` //
+	MaxEntries *int     `json:"max_entries"` //
+	MinLevel   *int     `json:"min_level"`   // contributor level required
+	MaxLevel   *int     `json:"max_level"`   //
+	MinLeft    string   `json:"min_left"`    // time till giveaway end (like "1h")
+	MaxLeft    string   `json:"max_left"`    //
+
+	name    *regexp.Regexp
+	minLeft time.Duration
+	maxLeft time.Duration
+}
+
+// Rules sorted by priority (desc)
+type Rules []Rule
+
+// loadRules reads rules from json file
+func loadRules(path string) ([]Rule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	err = json.Unmarshal(raw, &rules)
+	if err != nil {
+		return nil, fmt.Errorf("can't parse rules file %s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// parseRules validates rules and sorts them by priority. rules with equal priority keep the order
+func parseRules(rules []Rule) (Rules, error) {
+	out := make(Rules, 0, len(rules))
+	for i, rule := range rules {
+		invalid := func(what string) error {
+			return &BotError{When: time.Now(), What: fmt.Sprintf("invalid rule #%d '%s': %s", i+1, rule.Title, what)}
+		}
+
+		if rule.Action != ruleInclude && rule.Action != ruleExclude {
+			return nil, invalid(fmt.Sprintf("unknown action '%s'", rule.Action))
+		}
+
+		if rule.Name != "" {
+			re, err := regexp.Compile("(?i)" + rule.Name)
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			rule.name = re
+		}
+
+		for _, left := range []struct {
+			value string
+			out   *time.Duration
+		}{{rule.MinLeft, &rule.minLeft}, {rule.MaxLeft, &rule.maxLeft}} {
+			if left.value == "" {
+				continue
+			}
+			d, err := time.ParseDuration(left.value)
+			if err != nil {
+				return nil, invalid(err.Error())
+			}
+			*left.out = d
+		}
+
+		out = append(out, rule)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Priority > out[j].Priority
+	})
+	return out, nil
+}
+
+func inRange(value int, min *int, max *int) bool {
+	return (min == nil || value >= *min) && (max == nil || value <= *max)
+}
+
+// matches checks giveaway found in source. lists - lists the game is whitelisted by
+func (r *Rule) matches(ga GiveAway, source string, lists []string, now time.Time) bool {
+	if len(r.Apps) > 0 && !slices.Contains(r.Apps, ga.GID) {
+		return false
+	}
+	if r.name != nil && !r.name.MatchString(ga.Name) {
+		return false
+	}
+	if len(r.Lists) > 0 && !slices.ContainsFunc(lists, func(l string) bool { return slices.Contains(r.Lists, l) }) {
+		return false
+	}
+	if len(r.Sources) > 0 && !slices.Contains(r.Sources, source) {
+		return false
+	}
+	if len(r.Creators) > 0 && !slices.Contains(r.Creators, ga.Creator) {
+		return false
+	}
+
+	if !inRange(ga.Points, r.MinPoints, r.MaxPoints) || !inRange(ga.Copies, r.MinCopies, r.MaxCopies) ||
+		!inRange(ga.Entries, r.MinEntries, r.MaxEntries) || !inRange(ga.Level, r.MinLevel, r.MaxLevel) {
+		return false
+	}
+
+	left := ga.Time.Sub(now)
+	if r.MinLeft != "" && left < r.minLeft {
+		return false
+	}
+	return r.MaxLeft == "" || left <= r.maxLeft
+}
+
+// decide if giveaway is entered: the first matched rule decides, whitelisted games are entered if no rule matches
+func (rs Rules) decide(ga GiveAway, source string, lists []string, whitelisted bool, now time.Time) (bool, *Rule) {
+	for i := range rs {
+		if rs[i].matches(ga, source, lists, now) {
+			return rs[i].Action == ruleInclude, &rs[i]
+		}
+	}
+	return whitelisted, nil
+}
+
+// mayInclude checks if not whitelisted game can be included by rules with apps or name conditions
+// (other conditions are checked later with decide)
+func (rs Rules) mayInclude(gid uint64, name string) bool {
+	for _, r := range rs {
+		if r.Action != ruleInclude || len(r.Apps) == 0 && r.name == nil {
+			continue
+		}
+		if (len(r.Apps) == 0 || slices.Contains(r.Apps, gid)) && (r.name == nil || r.name.MatchString(name)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Scorer rates giveaway for entering, bigger is better.
+// priority - steam wishlist priority of the game (1 - top, 0 - not in wishlist or not ranked)
+type Scorer func(ga *GiveAway, now time.Time, priority int) float64
+
+const (
+	scoreTime     string = "time"     // first ends - first entered
+	scoreChance   string = "chance"   // win probability per point
+	scorePriority string = "priority" // win probability per point, boosted by wishlist priority
+
+	defaultScoring string = scorePriority
+)
+
+var scorers = map[string]Scorer{
+	scoreTime:     scoreByTime,
+	scoreChance:   scoreByChance,
+	scorePriority: scoreByPriority,
+}
+
+func getScorer(name string) (Scorer, error) {
+	if name == "" {
+		name = defaultScoring
+	}
+
+	scorer, ok := scorers[name]
+	if !ok {
+		return nil, &BotError{When: time.Now(), What: fmt.Sprintf("unknown scoring '%s'", name)}
+	}
+	return scorer, nil
+}
+
+// winChance estimates probability to win: copies to entries expected at the end.
+// entries grow with the same rate as they did since giveaway creation
+func winChance(ga *GiveAway, now time.Time) float64 {
+	entries := float64(ga.Entries)
+	age := now.Sub(ga.Created)
+	left := ga.Time.Sub(now)
+	if !ga.Created.IsZero() && age > 0 && left > 0 {
+		entries += entries / age.Seconds() * left.Seconds()
+	}
+
+	return math.Min(1, float64(max(ga.Copies, 1))/(entries+1))
+}
+
+func scoreByTime(ga *GiveAway, now time.Time, _ int) float64 {
+	return -ga.Time.Sub(now).Seconds()
+}
+
+func scoreByChance(ga *GiveAway, now time.Time, _ int) float64 {
+	return winChance(ga, now) / float64(max(ga.Points, 1))
+}
+
+func scoreByPriority(ga *GiveAway, now time.Time, priority int) float64 {
+	score := scoreByChance(ga, now, priority)
+	if priority > 0 {
+		score *= 1 + 1/float64(priority)
+	}
+	return score
+}
+
+// rankGiveaways sorts giveaways by score desc, giveaways with equal score - in random order
+// (or by end time asc if pacing is ordered). top wishlist games go first by priority and date added
+func (b *TheBot) rankGiveaways(giveaways []GiveAway) {
+	b.pacer.shuffle(giveaways)
+
+	now := time.Now()
+	scores := make(map[string]float64, len(giveaways))
+	for i := range giveaways {
+		ga := &giveaways[i]
+		scores[ga.SGID] = b.scorer(ga, now, b.wishlistPriority(ga.GID))
+	}
+
+	byScore := func(t1, t2 *GiveAway) bool {
+		top1, top2 := b.topWishlistGame(t1.GID), b.topWishlistGame(t2.GID)
+		if top1 != top2 {
+			return top1
+		}
+		if top1 && t1.GID != t2.GID {
+			g1, g2 := b.gamesWhitelist[t1.GID], b.gamesWhitelist[t2.GID]
+			if g1.Priority != g2.Priority {
+				return g1.Priority < g2.Priority
+			}
+			return g1.Added.Before(g2.Added)
+		}
+		if scores[t1.SGID] != scores[t2.SGID] {
+			return scores[t1.SGID] > scores[t2.SGID]
+		}
+		return b.pacer.Ordered && t1.Time.UnixNano() < t2.Time.UnixNano()
+	}
+	By(byScore).sortGAs(giveaways)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	searchByApp  string = "app"
+	searchByName string = "name"
+)
+
+// gameSearch settings of direct search on steamgifts for whitelisted games
+type gameSearch struct {
+	budget   int           // queries per run, 0 - search disabled
+	by       string        // app (app id) or name (game name, app id if name is unknown)
+	interval time.Duration // do not search the game again during this interval
+	names    map[uint64]string
+}
+
+func (b *TheBot) setSearch(budget int, by string, interval time.Duration, names map[uint64]string) {
+	if by != searchByName {
+		by = searchByApp
+	}
+	b.search = gameSearch{budget: budget, by: by, interval: interval, names: names}
+}
+
+// searchURL makes search query for the game
+func (b *TheBot) searchURL(gid uint64) string {
+	q := url.Values{}
+	if name := b.search.names[gid]; b.search.by == searchByName && name != "" {
+		q.Set("q", name)
+	} else {
+		q.Set("app", strconv.FormatUint(gid, 10))
+	}
+	return sgSearchURL + "?" + q.Encode()
+}
+
+// pruneSearched forgets searches of games which aren't whitelisted anymore
+func (b *TheBot) pruneSearched() {
+	for gid := range b.state.Searched {
+		if _, ok := b.gamesWhitelist[gid]; !ok {
+			delete(b.state.Searched, gid)
+		}
+	}
+}
+
+// searchBatch picks whitelisted games not searched recently, least recently searched first
+func (b *TheBot) searchBatch() (batch []uint64) {
+	b.pruneSearched()
+	if b.search.budget <= 0 {
+		return
+	}
+
+	now := time.Now()
+	for gid := range b.gamesWhitelist {
+		last := time.Unix(b.state.Searched[gid], 0)
+		if now.Sub(last) < b.search.interval {
+			continue
+		}
+		batch = append(batch, gid)
+	}
+
+	sort.Slice(batch, func(i, j int) bool {
+		ti, tj := b.state.Searched[batch[i]], b.state.Searched[batch[j]]
+		if ti != tj {
+			return ti < tj
+		}
+		return batch[i] < batch[j]
+	})
+
+	if len(batch) > b.search.budget {
+		batch = batch[:b.search.budget]
+	}
+	return
+}
+
+// searchGames queries steamgifts for a batch of whitelisted games (one page per game)
+func (b *TheBot) searchGames(ctx context.Context) (giveaways []GiveAway, token string) {
+	batch := b.searchBatch()
+	if len(batch) == 0 {
+		return
+	}
+
+	stdlog.Println("search games", len(batch))
+	seen := make(map[string]bool)
+	for _, gid := range batch {
+		if timeIsOver(ctx) {
+			stdlog.Println("no time left for search. stop")
+			break
+		}
+
+		doc, err := b.getPageCustom(ctx, baseURL+b.searchURL(gid))
+		if err != nil {
+			errlog.Println("can't search game", gid, err)
+			continue
+		}
+
+		t, err := b.getToken(doc)
+		if err != nil {
+			errlog.Println("can't search game", gid, err)
+			break
+		}
+		token = t
+		b.updatePoints(doc)
+		b.state.Searched[gid] = time.Now().Unix()
+
+		for _, ga := range b.getGiveaways(ctx, doc) {
+			if seen[ga.SGID] || b.history.entered(ga.SGID) {
+				continue
+			}
+			seen[ga.SGID] = true
+			giveaways = append(giveaways, ga)
+		}
+	}
+
+	return
+}
@@ -11,7 +11,7 @@ func (by By) sortGAs(entries []GiveAway) {
 		entries: entries,
 		by:      by, // The Sort method's receiver is the function (closure) that defines the sort order.
 	}
-	sort.Sort(ps)
+	sort.Stable(ps)
 }
 
 // timeSorter joins a By function and a slice of Time to be sorted.
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	sourceWishlist    string = "wishlist"
+	sourceAll         string = "all"
+	sourceGroup       string = "group"
+	sourceRecommended string = "recommended"
+	sourceNew         string = "new"
+	sourceDLC         string = "dlc"
+	sourceMultiple    string = "multiple"
+	sourceSearch      string = "search" // direct search for whitelisted games (not a listing)
+
+	allGiveawaysWindow time.Duration = time.Hour * 24 * 7 * 5 // 5 weeks - all
+)
+
+// steamgifts listing paths by source type
+var sourcePaths = map[string]string{
+	sourceWishlist:    sgWishlistURL,
+	sourceAll:         "",
+	sourceGroup:       sgSearchURL + "?type=group",
+	sourceRecommended: sgSearchURL + "?type=recommended",
+	sourceNew:         sgSearchURL + "?type=new",
+	sourceDLC:         sgSearchURL + "?dlc=true",
+	sourceMultiple:    sgSearchURL + "?copy_min=2",
+}
+
+// Source steamgifts listing to check for giveaways
+type Source struct {
+	Type   string `json:"type"`   // wishlist, all, group, recommended, new, dlc or multiple
+	Window string `json:"window"` // enter giveaways which end within window (like "1h" or "840h"), empty - all
+	Pages  int    `json:"pages"`  // pages to walk, 0 - bot default
+
+	// which sub giveaways are entered, nil - with at least one whitelisted app
+	Bundle *BundlePolicy `json:"bundle"`
+
+	window time.Duration
+}
+
+// BundlePolicy requires enough whitelisted apps in sub giveaway
+type BundlePolicy struct {
+	MinApps    int  `json:"min_apps"`    // whitelisted apps at least, 0 - one
+	MinPercent int  `json:"min_percent"` // whitelisted share of package apps at least, %
+	Primary    bool `json:"primary"`     // the primary (first listed) app of package is whitelisted
+}
+
+// allows checks giveaway with the policy. single games are always allowed
+func (p *BundlePolicy) allows(ga GiveAway) bool {
+	if p == nil || ga.Apps == 0 {
+		return true
+	}
+
+	if len(ga.Matched) < max(p.MinApps, 1) {
+		return false
+	}
+	if len(ga.Matched)*100 < p.MinPercent*ga.Apps {
+		return false
+	}
+	return !p.Primary || ga.Matched[0] == ga.Primary
+}
+
+// default sources: all wishlist giveaways and main page giveaways which end within an hour
+func defaultSources() []Source {
+	return []Source{
+		{Type: sourceWishlist, window: allGiveawaysWindow},
+		{Type: sourceAll, Window: "1h", window: time.Hour},
+	}
+}
+
+// parseSources validates sources configuration
+func parseSources(sources []Source) ([]Source, error) {
+	if len(sources) == 0 {
+		return defaultSources(), nil
+	}
+
+	out := make([]Source, 0, len(sources))
+	for _, src := range sources {
+		if _, ok := sourcePaths[src.Type]; !ok {
+			return nil, &BotError{When: time.Now(), What: fmt.Sprintf("unknown source type '%s'", src.Type)}
+		}
+
+		if b := src.Bundle; b != nil && (b.MinApps < 0 || b.MinPercent < 0 || b.MinPercent > 100) {
+			return nil, &BotError{When: time.Now(), What: fmt.Sprintf("invalid bundle policy %+v for source '%s'", *b, src.Type)}
+		}
+
+		src.window = allGiveawaysWindow
+		if src.Window != "" {
+			d, err := time.ParseDuration(src.Window)
+			if err != nil || d <= 0 {
+				return nil, &BotError{When: time.Now(), What: fmt.Sprintf("invalid window '%s' for source '%s'", src.Window, src.Type)}
+			}
+			src.window = d
+		}
+
+		out = append(out, src)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+)
+
+const stateName string = "sgbot"
+
+// BotState data kept between bot runs (stored as json document)
+type BotState struct {
+	// steamgifts search: app id -> unix time of the last search
+	Searched map[uint64]int64 `json:"searched"`
+
+	// known wins: steamgifts code -> unix time when win was found. nil - wins weren't checked yet
+	Wins map[string]int64 `json:"wins"`
+
+	// unix time of the last entries reconciliation
+	Reconciled int64 `json:"reconciled"`
+
+	// owned whitelisted games: app id -> unix time when it was found owned. nil - library wasn't checked yet
+	Owned map[uint64]int64 `json:"owned"`
+
+	// unix times of entries made during the last day (pacing caps)
+	Recent []int64 `json:"recent"`
+
+	// apps of steam packages: package id -> apps
+	Packages map[uint64]*CachedPackage `json:"packages"`
+}
+
+func newBotState() *BotState {
+	return &BotState{
+		Searched: make(map[uint64]int64),
+		Packages: make(map[uint64]*CachedPackage),
+	}
+}
+
+// parseBotState decodes stored state. broken or empty state starts from scratch
+func parseBotState(raw string) *BotState {
+	state := newBotState()
+	if raw == "" {
+		return state
+	}
+
+	err := json.Unmarshal([]byte(raw), state)
+	if err != nil {
+		errlog.Println("can't parse bot state, reset it.", err)
+		return newBotState()
+	}
+
+	if state.Searched == nil {
+		state.Searched = make(map[uint64]int64)
+	}
+	if state.Packages == nil {
+		state.Packages = make(map[uint64]*CachedPackage)
+	}
+
+	return state
+}
+
+func (s *BotState) String() string {
+	raw, err := json.Marshal(s)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
@@ -0,0 +1,444 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// files of json storage (see assets/*.example.json)
+const (
+	jsonGamesFile    string = "gameslist.json" // {"<app id>": "<name>"}
+	jsonCookiesFile  string = "cookies.json"   // {"<name>": "<value>:<domain>:<path>"}
+	jsonAccountsFile string = "accounts.json"  // [{"name": "...", "profile": "...", "settings": {...}, "cookies": {...}}]
+	jsonEntriesFile  string = "entries.json"   // {"<account>": [entries]}
+	jsonStateFile    string = "state.json"     // {"<name>": "<state document>"}
+	jsonDigestFile   string = "digest.json"    // ["<message>"] digest of old versions
+	jsonEventsFile   string = "events.json"    // [digest events with delivery]
+	jsonSchemaFile   string = "schema.json"    // [applied migrations]
+)
+
+// jsonAccount account in accounts file
+type jsonAccount struct {
+	Name          string            `json:"name"`
+	SteamProfile  string            `json:"profile"`
+	SteamAPIKey   string            `json:"steam_key"`
+	PointsReserve int               `json:"points_reserve"`
+	Settings      json.RawMessage   `json:"settings"`
+	Cookies       map[string]string `json:"cookies"`
+}
+
+// jsonEvent digest event with its delivery
+type jsonEvent struct {
+	DigestEvent
+	Claim   string `json:"claim,omitempty"`
+	Claimed int64  `json:"claimed,omitempty"`
+	Sent    int64  `json:"sent,omitempty"`
+}
+
+// jsonStorage keeps data in json files of the directory (for local runs)
+type jsonStorage struct {
+	dir string
+	mu  sync.Mutex
+}
+
+func openJSONStorage(_ context.Context, cfg StorageConfig) (Storage, error) {
+	return &jsonStorage{dir: cfg.Path}, nil
+}
+
+func (s *jsonStorage) Close(context.Context) error {
+	return nil
+}
+
+// load reads file into v, missing file is empty
+func (s *jsonStorage) load(name string, v any) error {
+	raw, err := os.ReadFile(filepath.Join(s.dir, name))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	err = json.Unmarshal(raw, v)
+	if err != nil {
+		return fmt.Errorf("can't parse %s: %v", name, err)
+	}
+	return nil
+}
+
+// save replaces file with v
+func (s *jsonStorage) save(name string, v any) error {
+	raw, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, name)
+	err = os.WriteFile(path+".tmp", raw, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+// jsonTables files of tables, tables without own file (like account_cookies) are kept in other files
+var jsonTables = map[string]struct {
+	file  string
+	empty any
+}{
+	"games":    {jsonGamesFile, map[string]string{}},
+	"cookies":  {jsonCookiesFile, map[string]string{}},
+	"accounts": {jsonAccountsFile, []jsonAccount{}},
+	"entries":  {jsonEntriesFile, map[string][]Entry{}},
+	"state":    {jsonStateFile, map[string]string{}},
+	"digest":   {jsonDigestFile, []string{}},
+
+	"digest_events": {jsonEventsFile, []jsonEvent{}},
+
+	"schema_version": {jsonSchemaFile, []jsonMigration{}},
+}
+
+// jsonMigration applied migration
+type jsonMigration struct {
+	Version int    `json:"version"`
+	Title   string `json:"title"`
+	Applied int64  `json:"applied"`
+}
+
+func (s *jsonStorage) SchemaVersion(context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := make([]jsonMigration, 0)
+	err := s.load(jsonSchemaFile, &applied)
+
+	version := 0
+	for _, m := range applied {
+		version = max(version, m.Version)
+	}
+	return version, err
+}
+
+func (s *jsonStorage) RecordMigration(ctx context.Context, m Migration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	applied := make([]jsonMigration, 0)
+	err := s.load(jsonSchemaFile, &applied)
+	if err != nil {
+		return err
+	}
+	applied = append(applied, jsonMigration{Version: m.Version, Title: m.Title, Applied: time.Now().Unix()})
+	return s.save(jsonSchemaFile, applied)
+}
+
+// MigrateStep creates files of new tables. documents have no schema, so columns aren't changed
+func (s *jsonStorage) MigrateStep(_ context.Context, step MigrationStep, dryRun bool) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	table, ok := jsonTables[step.Table]
+	if step.Kind != stepCreateTable || !ok {
+		return "", nil
+	}
+
+	_, err := os.Stat(filepath.Join(s.dir, table.file))
+	if err == nil {
+		return "", nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", err
+	}
+
+	statement := fmt.Sprintf("create %s", filepath.Join(s.dir, table.file))
+	if dryRun {
+		return statement, nil
+	}
+
+	err = os.MkdirAll(s.dir, 0700)
+	if err != nil {
+		return "", err
+	}
+	return statement, s.save(table.file, table.empty)
+}
+
+func (s *jsonStorage) Games(context.Context) ([]Game, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := make(map[string]string)
+	err := s.load(jsonGamesFile, &list)
+	if err != nil {
+		return nil, err
+	}
+
+	games := make([]Game, 0, len(list))
+	for id, name := range list {
+		gid, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			fmt.Println("invalid game id", id)
+			continue
+		}
+		games = append(games, Game{Id: gid, Name: name})
+	}
+	sort.Slice(games, func(i, j int) bool { return games[i].Id < games[j].Id })
+	return games, nil
+}
+
+// parseCookies reads cookies like {"PHPSESSID": "<value>:www.steamgifts.com:/"} which domain contains domain
+func parseCookies(cookies map[string]string, domain string) []Cookie {
+	out := make([]Cookie, 0, len(cookies))
+	for name, raw := range cookies {
+		parts := strings.Split(raw, ":")
+		if len(parts) < 3 {
+			fmt.Println("invalid cookie", name)
+			continue
+		}
+
+		c := Cookie{
+			Name:   name,
+			Value:  strings.Join(parts[:len(parts)-2], ":"),
+			Domain: parts[len(parts)-2],
+			Path:   parts[len(parts)-1],
+		}
+		if strings.Contains(c.Domain, domain) {
+			out = append(out, c)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+func (s *jsonStorage) Cookies(_ context.Context, account string, domain string) ([]Cookie, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if account == defaultAccount {
+		cookies := make(map[string]string)
+		err := s.load(jsonCookiesFile, &cookies)
+		return parseCookies(cookies, domain), err
+	}
+
+	accounts := make([]jsonAccount, 0)
+	err := s.load(jsonAccountsFile, &accounts)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range accounts {
+		if a.Name == account {
+			return parseCookies(a.Cookies, domain), nil
+		}
+	}
+	return []Cookie{}, nil
+}
+
+func (s *jsonStorage) Accounts(context.Context) ([]Account, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	accounts := make([]jsonAccount, 0)
+	err := s.load(jsonAccountsFile, &accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Account, 0, len(accounts))
+	for _, a := range accounts {
+		out = append(out, Account{
+			Name:          a.Name,
+			SteamProfile:  a.SteamProfile,
+			SteamAPIKey:   a.SteamAPIKey,
+			PointsReserve: a.PointsReserve,
+			Settings:      string(a.Settings),
+		})
+	}
+	return out, nil
+}
+
+func (s *jsonStorage) Entries(_ context.Context, account string, ends int64) ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make(map[string][]Entry)
+	err := s.load(jsonEntriesFile, &entries)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]Entry, 0)
+	for _, e := range entries[account] {
+		if e.Ends >= ends {
+			out = append(out, e)
+		}
+	}
+	return out, nil
+}
+
+func (s *jsonStorage) SaveEntries(_ context.Context, account string, changed []Entry) error {
+	if len(changed) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make(map[string][]Entry)
+	err := s.load(jsonEntriesFile, &entries)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range changed {
+		i := 0
+		for ; i < len(entries[account]); i++ {
+			if entries[account][i].SGID == e.SGID {
+				break
+			}
+		}
+		if i < len(entries[account]) {
+			entries[account][i] = e
+		} else {
+			entries[account] = append(entries[account], e)
+		}
+	}
+	return s.save(jsonEntriesFile, entries)
+}
+
+func (s *jsonStorage) State(_ context.Context, name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]string)
+	err := s.load(jsonStateFile, &states)
+	return states[name], err
+}
+
+func (s *jsonStorage) SaveState(_ context.Context, name string, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[string]string)
+	err := s.load(jsonStateFile, &states)
+	if err != nil {
+		return err
+	}
+	states[name] = value
+	return s.save(jsonStateFile, states)
+}
+
+func (s *jsonStorage) AddDigest(_ context.Context, events []DigestEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digest := make([]jsonEvent, 0)
+	err := s.load(jsonEventsFile, &digest)
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		digest = append(digest, jsonEvent{DigestEvent: e})
+	}
+	return s.save(jsonEventsFile, digest)
+}
+
+// updateDigest changes digest events with update, which returns false if nothing is changed
+func (s *jsonStorage) updateDigest(update func(digest []jsonEvent) ([]jsonEvent, bool)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digest := make([]jsonEvent, 0)
+	err := s.load(jsonEventsFile, &digest)
+	if err != nil {
+		return err
+	}
+
+	digest, changed := update(digest)
+	if !changed {
+		return nil
+	}
+	return s.save(jsonEventsFile, digest)
+}
+
+func (s *jsonStorage) ClaimDigest(_ context.Context, claim string, now int64) ([]DigestEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	digest := make([]jsonEvent, 0)
+	err := s.load(jsonEventsFile, &digest)
+	if err != nil {
+		return nil, err
+	}
+
+	// messages of old versions are moved to events
+	messages := make([]string, 0)
+	err = s.load(jsonDigestFile, &messages)
+	if err != nil {
+		return nil, err
+	}
+	for _, msg := range messages {
+		digest = append(digest, jsonEvent{DigestEvent: DigestEvent{ID: "message:" + msg, Kind: eventMessage, Text: msg}})
+	}
+
+	events := make([]DigestEvent, 0)
+	for i, e := range digest {
+		if e.Sent != 0 || e.Claim != "" && e.Claimed >= claimExpired(now) {
+			continue
+		}
+		digest[i].Claim, digest[i].Claimed = claim, now
+		events = append(events, e.DigestEvent)
+	}
+	if len(events) == 0 && len(messages) == 0 {
+		return events, nil
+	}
+
+	err = s.save(jsonEventsFile, digest)
+	if err != nil || len(messages) == 0 {
+		return events, err
+	}
+	return events, s.save(jsonDigestFile, []string{})
+}
+
+func (s *jsonStorage) ReleaseDigest(_ context.Context, claim string) error {
+	return s.updateDigest(func(digest []jsonEvent) ([]jsonEvent, bool) {
+		changed := false
+		for i, e := range digest {
+			if e.Claim == claim && e.Sent == 0 {
+				digest[i].Claim, digest[i].Claimed = "", 0
+				changed = true
+			}
+		}
+		return digest, changed
+	})
+}
+
+func (s *jsonStorage) MarkDigestSent(_ context.Context, claim string, now int64) error {
+	return s.updateDigest(func(digest []jsonEvent) ([]jsonEvent, bool) {
+		changed := false
+		for i, e := range digest {
+			if e.Claim == claim && e.Sent == 0 {
+				digest[i].Sent = now
+				changed = true
+			}
+		}
+
+		kept := slices.DeleteFunc(digest, func(e jsonEvent) bool {
+			return e.Sent != 0 && e.Sent < sentExpired(now)
+		})
+		return kept, changed || len(kept) != len(digest)
+	})
+}
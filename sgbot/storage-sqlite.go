@@ -0,0 +1,356 @@
+//go:build sqlite
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqlite storage requires cgo, so it's built with 'sqlite' tag only (go build -tags sqlite)
+func init() {
+	storageOpeners[storageSQLite] = openSQLiteStorage
+}
+
+// sqliteStorage keeps data in embedded sqlite database file (for local runs)
+type sqliteStorage struct {
+	db *sql.DB
+}
+
+func openSQLiteStorage(ctx context.Context, cfg StorageConfig) (Storage, error) {
+	db, err := sql.Open("sqlite3", cfg.Path+"?_busy_timeout=5000&_journal_mode=WAL")
+	if err != nil {
+		return nil, err
+	}
+	err = db.PingContext(ctx)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &sqliteStorage{db: db}, nil
+}
+
+func (s *sqliteStorage) Close(context.Context) error {
+	return s.db.Close()
+}
+
+// sqliteColumnTypes column types of migrations
+var sqliteColumnTypes = map[string]string{
+	columnText:   "TEXT",
+	columnBytes:  "TEXT",
+	columnUint64: "INTEGER",
+	columnInt64:  "INTEGER",
+}
+
+// columns of the table, nil - no such table
+func (s *sqliteStorage) columns(ctx context.Context, table string) (columns []string, err error) {
+	err = s.query(ctx, func(rows *sql.Rows) error {
+		var name string
+		err := rows.Scan(&name)
+		columns = append(columns, name)
+		return err
+	}, `SELECT name FROM pragma_table_info(?)`, table)
+	return
+}
+
+// keyColumns primary key of the table in order
+func (s *sqliteStorage) keyColumns(ctx context.Context, table string) (key []string, err error) {
+	err = s.query(ctx, func(rows *sql.Rows) error {
+		var name string
+		err := rows.Scan(&name)
+		key = append(key, name)
+		return err
+	}, `SELECT name FROM pragma_table_info(?) WHERE pk > 0 ORDER BY pk`, table)
+	return
+}
+
+// sqliteCreateTable statement of the table with columns and key of the step
+func sqliteCreateTable(table string, step MigrationStep) string {
+	defs := make([]string, 0, len(step.Columns))
+	for _, c := range step.Columns {
+		defs = append(defs, fmt.Sprintf("%s %s", c.Name, sqliteColumnTypes[c.Type]))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s, PRIMARY KEY (%s))", table, strings.Join(defs, ", "), strings.Join(step.Key, ", "))
+}
+
+func (s *sqliteStorage) SchemaVersion(ctx context.Context) (int, error) {
+	columns, err := s.columns(ctx, schemaVersionTable.Table)
+	if err != nil || columns == nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+	err = s.query(ctx, func(rows *sql.Rows) error {
+		return rows.Scan(&version)
+	}, `SELECT MAX(version) FROM schema_version`)
+	return int(version.Int64), err
+}
+
+func (s *sqliteStorage) RecordMigration(ctx context.Context, m Migration) error {
+	_, err := s.MigrateStep(ctx, schemaVersionTable, false)
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, `REPLACE INTO schema_version (version, title, applied) VALUES (?, ?, ?)`, []any{m.Version, m.Title, time.Now().Unix()})
+}
+
+func (s *sqliteStorage) MigrateStep(ctx context.Context, step MigrationStep, dryRun bool) (string, error) {
+	columns, err := s.columns(ctx, step.Table)
+	if err != nil {
+		return "", err
+	}
+
+	statements := make([]string, 0)
+	switch step.Kind {
+	case stepCreateTable:
+		if columns != nil {
+			return "", nil
+		}
+		statements = append(statements, sqliteCreateTable(step.Table, step))
+	case stepAddColumn:
+		if columns == nil && dryRun {
+			return "", nil // table is created by pending migration
+		}
+		if columns == nil {
+			return "", fmt.Errorf("no table %s", step.Table)
+		}
+		// sqlite adds one column per statement
+		for _, c := range step.Columns {
+			if !slices.Contains(columns, c.Name) {
+				statements = append(statements, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", step.Table, c.Name, sqliteColumnTypes[c.Type]))
+			}
+		}
+	case stepRebuildTable:
+		if columns == nil && dryRun {
+			return "", nil // table is created by pending migration
+		}
+		if columns == nil {
+			return "", fmt.Errorf("no table %s", step.Table)
+		}
+		key, err := s.keyColumns(ctx, step.Table)
+		if err != nil {
+			return "", err
+		}
+		if slices.Equal(key, step.Key) {
+			return "", nil
+		}
+
+		rebuilt := step.Table + rebuildSuffix
+		names := make([]string, 0, len(step.Columns))
+		values := make([]string, 0, len(step.Columns))
+		for _, c := range step.Columns {
+			names = append(names, c.Name)
+			if slices.Contains(columns, c.Name) {
+				values = append(values, c.Name)
+			} else {
+				values = append(values, "'"+strings.ReplaceAll(step.Value, "'", "''")+"'")
+			}
+		}
+		statements = append(statements,
+			sqliteCreateTable(rebuilt, step),
+			fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", rebuilt, strings.Join(names, ", "), strings.Join(values, ", "), step.Table),
+			fmt.Sprintf("DROP TABLE %s", step.Table),
+			fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuilt, step.Table),
+		)
+	default:
+		return "", fmt.Errorf("unknown migration step '%s'", step.Kind)
+	}
+
+	statement := strings.Join(statements, ";\n")
+	if dryRun || statement == "" {
+		return statement, nil
+	}
+
+	// statements of the step are applied at once
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return statement, err
+	}
+	if _, err = tx.ExecContext(ctx, statement); err != nil {
+		_ = tx.Rollback()
+		return statement, err
+	}
+	return statement, tx.Commit()
+}
+
+// query passes every row to scan
+func (s *sqliteStorage) query(ctx context.Context, scan func(rows *sql.Rows) error, query string, args ...any) error {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		err = scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exec runs statement for every args in one transaction
+func (s *sqliteStorage) exec(ctx context.Context, statement string, args ...[]any) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, a := range args {
+		_, err = tx.ExecContext(ctx, statement, a...)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStorage) Games(ctx context.Context) ([]Game, error) {
+	games := make([]Game, 0)
+	err := s.query(ctx, func(rows *sql.Rows) error {
+		var game Game
+		var name sql.NullString
+		err := rows.Scan(&game.Id, &name)
+		game.Name = name.String
+		games = append(games, game)
+		return err
+	}, `SELECT id, name FROM games ORDER BY id`)
+	return games, err
+}
+
+func (s *sqliteStorage) Cookies(ctx context.Context, account string, domain string) ([]Cookie, error) {
+	query := `SELECT name, COALESCE(value, ''), COALESCE(domain, ''), COALESCE(path, '') FROM account_cookies WHERE account = ? AND domain LIKE ? ORDER BY name`
+	args := []any{account, "%" + domain + "%"}
+	if account == defaultAccount {
+		query = `SELECT name, COALESCE(value, ''), COALESCE(domain, ''), COALESCE(path, '') FROM cookies WHERE domain LIKE ? ORDER BY name`
+		args = args[1:]
+	}
+
+	cookies := make([]Cookie, 0)
+	err := s.query(ctx, func(rows *sql.Rows) error {
+		var c Cookie
+		err := rows.Scan(&c.Name, &c.Value, &c.Domain, &c.Path)
+		cookies = append(cookies, c)
+		return err
+	}, query, args...)
+	return cookies, err
+}
+
+func (s *sqliteStorage) Accounts(ctx context.Context) ([]Account, error) {
+	accounts := make([]Account, 0)
+	err := s.query(ctx, func(rows *sql.Rows) error {
+		var a Account
+		var profile, key, settings sql.NullString
+		var reserve sql.NullInt64
+		err := rows.Scan(&a.Name, &profile, &key, &reserve, &settings)
+		a.SteamProfile, a.SteamAPIKey, a.PointsReserve, a.Settings = profile.String, key.String, int(reserve.Int64), settings.String
+		accounts = append(accounts, a)
+		return err
+	}, `SELECT name, profile, steam_key, points_reserve, settings FROM accounts ORDER BY name`)
+	return accounts, err
+}
+
+func (s *sqliteStorage) Entries(ctx context.Context, account string, ends int64) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	err := s.query(ctx, func(rows *sql.Rows) error {
+		var e Entry
+		err := rows.Scan(&e.SGID, &e.GID, &e.Points, &e.Time, &e.Ends, &e.Result)
+		entries = append(entries, e)
+		return err
+	}, `SELECT sgid, gid, points, time, ends, result FROM entries WHERE account = ? AND ends >= ?`, account, ends)
+	return entries, err
+}
+
+func (s *sqliteStorage) SaveEntries(ctx context.Context, account string, entries []Entry) error {
+	args := make([][]any, 0, len(entries))
+	for _, e := range entries {
+		args = append(args, []any{account, e.SGID, e.GID, e.Points, e.Time, e.Ends, e.Result})
+	}
+	return s.exec(ctx, `REPLACE INTO entries (account, sgid, gid, points, time, ends, result) VALUES (?, ?, ?, ?, ?, ?, ?)`, args...)
+}
+
+func (s *sqliteStorage) State(ctx context.Context, name string) (string, error) {
+	var value string
+	err := s.query(ctx, func(rows *sql.Rows) error {
+		return rows.Scan(&value)
+	}, `SELECT value FROM state WHERE name = ?`, name)
+	return value, err
+}
+
+func (s *sqliteStorage) SaveState(ctx context.Context, name string, value string) error {
+	return s.exec(ctx, `REPLACE INTO state (name, value) VALUES (?, ?)`, []any{name, value})
+}
+
+func (s *sqliteStorage) AddDigest(ctx context.Context, events []DigestEvent) error {
+	args := make([][]any, 0, len(events))
+	for _, e := range events {
+		args = append(args, []any{e.ID, e.Time, e.Source, e.Account, e.Kind, e.PayloadJSON(), e.Text})
+	}
+	return s.exec(ctx, `REPLACE INTO digest_events (id, time, source, account, kind, payload, text) VALUES (?, ?, ?, ?, ?, ?, ?)`, args...)
+}
+
+func (s *sqliteStorage) ClaimDigest(ctx context.Context, claim string, now int64) ([]DigestEvent, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// messages of old versions are moved to events
+	_, err = tx.ExecContext(ctx, `INSERT OR IGNORE INTO digest_events (id, time, source, account, kind, payload, text)
+		SELECT 'message:' || message, 0, '', '', ?, '{}', message FROM digest`, eventMessage)
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.ExecContext(ctx, `DELETE FROM digest`)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE digest_events SET claim = ?, claimed = ? WHERE sent IS NULL AND (claim IS NULL OR claimed < ?)`,
+		claim, now, claimExpired(now))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT id, time, source, account, kind, payload, text FROM digest_events
+		WHERE claim = ? AND sent IS NULL ORDER BY time, id`, claim)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]DigestEvent, 0)
+	for rows.Next() {
+		var e DigestEvent
+		var payload string
+		err = rows.Scan(&e.ID, &e.Time, &e.Source, &e.Account, &e.Kind, &payload, &e.Text)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		e.Payload = parsePayload(payload)
+		events = append(events, e)
+	}
+	rows.Close()
+	return events, tx.Commit()
+}
+
+func (s *sqliteStorage) ReleaseDigest(ctx context.Context, claim string) error {
+	return s.exec(ctx, `UPDATE digest_events SET claim = NULL, claimed = NULL WHERE claim = ? AND sent IS NULL`, []any{claim})
+}
+
+func (s *sqliteStorage) MarkDigestSent(ctx context.Context, claim string, now int64) error {
+	err := s.exec(ctx, `UPDATE digest_events SET sent = ? WHERE claim = ? AND sent IS NULL`, []any{now, claim})
+	if err != nil {
+		return err
+	}
+	return s.exec(ctx, `DELETE FROM digest_events WHERE sent < ?`, []any{sentExpired(now)})
+}
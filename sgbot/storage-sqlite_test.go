@@ -0,0 +1,76 @@
+//go:build sqlite
+
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSQLiteStorage(t *testing.T) {
+	s, err := openStorage(context.Background(), StorageConfig{Kind: storageSQLite, Path: filepath.Join(t.TempDir(), "sgbot.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(context.Background())
+
+	checkStorage(t, s)
+}
+
+func TestSQLiteMigrateLegacy(t *testing.T) {
+	ctx := context.Background()
+	s, err := openStorage(ctx, StorageConfig{Kind: storageSQLite, Path: filepath.Join(t.TempDir(), "sgbot.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close(ctx)
+
+	// tables of deployment made before migrations and accounts
+	_, err = s.(*sqliteStorage).db.ExecContext(ctx, `
+		CREATE TABLE games (id INTEGER PRIMARY KEY, name TEXT);
+		CREATE TABLE entries (sgid TEXT PRIMARY KEY, gid INTEGER, points INTEGER, time INTEGER, ends INTEGER, result TEXT);
+		INSERT INTO entries VALUES ('aAaA1', 100, 10, 100, 2000, 'entered');
+		CREATE TABLE digest (message TEXT PRIMARY KEY);
+		INSERT INTO digest VALUES ('message of old version');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := migrate(ctx, s, true)
+	if err != nil || !slices.ContainsFunc(pending, func(p string) bool {
+		return strings.Contains(p, "INSERT INTO entries_rebuild (account, sgid, gid, points, time, ends, result) SELECT '', sgid")
+	}) || slices.ContainsFunc(pending, func(p string) bool {
+		return strings.HasPrefix(p, "CREATE TABLE games")
+	}) {
+		t.Errorf("pending %q, %v", pending, err)
+	}
+
+	if _, err = migrate(ctx, s, false); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := s.Entries(ctx, defaultAccount, 1000)
+	if err != nil || len(entries) != 1 || entries[0].SGID != "aAaA1" {
+		t.Errorf("entries of default account %+v, %v", entries, err)
+	}
+
+	// the same giveaway is kept for every account
+	if err = s.SaveEntries(ctx, "second", entries); err != nil {
+		t.Fatal(err)
+	}
+	if entries, err = s.Entries(ctx, defaultAccount, 1000); err != nil || len(entries) != 1 {
+		t.Errorf("entries of default account are replaced %+v, %v", entries, err)
+	}
+	if pending, err = migrate(ctx, s, true); err != nil || len(pending) != 0 {
+		t.Errorf("pending after migration %q, %v", pending, err)
+	}
+
+	digest, err := s.ClaimDigest(ctx, "old", time.Now().Unix())
+	if err != nil || len(digest) != 1 || digest[0].Kind != eventMessage || digest[0].Text != "message of old version" || digest[0].ID == "" {
+		t.Errorf("digest of old version %+v, %v", digest, err)
+	}
+}
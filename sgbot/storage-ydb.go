@@ -0,0 +1,636 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	yc "github.com/yandex-cloud/go-sdk"
+	ycsdk "github.com/ydb-platform/ydb-go-sdk/v3"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/options"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/result/named"
+	"github.com/ydb-platform/ydb-go-sdk/v3/table/types"
+)
+
+// namedScanner row of query result
+type namedScanner interface {
+	ScanNamed(namedValues ...named.Value) error
+}
+
+// ydbStorage keeps data in yandex database (serverless YDB in cloud functions)
+type ydbStorage struct {
+	db ycsdk.Connection
+}
+
+// openYDBStorage connects with instance service account of cloud function
+func openYDBStorage(ctx context.Context, cfg StorageConfig) (Storage, error) {
+	if len(cfg.Database) == 0 {
+		return nil, fmt.Errorf("no ydb database name")
+	}
+
+	creds := yc.InstanceServiceAccount()
+	token, err := creds.IAMToken(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("can't get iam token. %v", err)
+	}
+
+	// Determine timeout for connect or do nothing
+	connectCtx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	db, err := ycsdk.Open(
+		connectCtx,
+		fmt.Sprintf("grpcs://ydb.serverless.yandexcloud.net:2135/?database=%s", cfg.Database),
+		ycsdk.WithAccessTokenCredentials(token.IamToken),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("ydb connect error: %w", err)
+	}
+	return &ydbStorage{db: db}, nil
+}
+
+func (s *ydbStorage) Close(ctx context.Context) error {
+	return s.db.Close(ctx)
+}
+
+// ydbColumnTypes column types of migrations
+var ydbColumnTypes = map[string]string{
+	columnText:   "Utf8",
+	columnBytes:  "String",
+	columnUint64: "Uint64",
+	columnInt64:  "Int64",
+}
+
+// describe returns table description, nil - no such table
+func (s *ydbStorage) describe(ctx context.Context, name string) (desc *options.Description, err error) {
+	err = s.db.Table().Do(ctx, func(ctxSession context.Context, session table.Session) error {
+		d, err := session.DescribeTable(ctxSession, path.Join(s.db.Name(), name))
+		if ycsdk.IsOperationErrorSchemeError(err) {
+			desc = nil
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		desc = &d
+		return nil
+	})
+	return
+}
+
+// ydbCreateTable statement of the table with columns and key of the step
+func ydbCreateTable(table string, step MigrationStep) string {
+	columns := make([]string, 0, len(step.Columns))
+	for _, c := range step.Columns {
+		columns = append(columns, fmt.Sprintf("%s %s", c.Name, ydbColumnTypes[c.Type]))
+	}
+	return fmt.Sprintf("CREATE TABLE %s (%s, PRIMARY KEY (%s))", table, strings.Join(columns, ", "), strings.Join(step.Key, ", "))
+}
+
+// scheme runs scheme query
+func (s *ydbStorage) scheme(ctx context.Context, statement string) error {
+	return s.db.Table().Do(ctx, func(ctxSession context.Context, session table.Session) error {
+		return session.ExecuteSchemeQuery(ctxSession, "--!syntax_v1\n"+statement)
+	})
+}
+
+func (s *ydbStorage) SchemaVersion(ctx context.Context) (int, error) {
+	desc, err := s.describe(ctx, schemaVersionTable.Table)
+	if err != nil || desc == nil {
+		return 0, err
+	}
+
+	var version int64
+	err = s.read(ctx,
+		`--!syntax_v1
+		SELECT MAX(version) AS version FROM schema_version
+		`,
+		nil,
+		func(row namedScanner) error {
+			return row.ScanNamed(named.OptionalWithDefault("version", &version))
+		},
+	)
+	return int(version), err
+}
+
+func (s *ydbStorage) RecordMigration(ctx context.Context, m Migration) error {
+	_, err := s.MigrateStep(ctx, schemaVersionTable, false)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx,
+		`--!syntax_v1
+		DECLARE $version AS Int64;
+		DECLARE $title AS Utf8;
+		DECLARE $applied AS Int64;
+
+		UPSERT INTO schema_version (version, title, applied) VALUES ($version, $title, $applied);
+		`,
+		table.NewQueryParameters(
+			table.ValueParam("$version", types.Int64Value(int64(m.Version))),
+			table.ValueParam("$title", types.UTF8Value(m.Title)),
+			table.ValueParam("$applied", types.Int64Value(time.Now().Unix())),
+		),
+	)
+}
+
+func (s *ydbStorage) MigrateStep(ctx context.Context, step MigrationStep, dryRun bool) (string, error) {
+	desc, err := s.describe(ctx, step.Table)
+	if err != nil {
+		return "", err
+	}
+
+	hasColumn := func(name string) bool {
+		for _, c := range desc.Columns {
+			if c.Name == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	var statement string
+	switch step.Kind {
+	case stepCreateTable:
+		if desc != nil {
+			return "", nil
+		}
+		statement = ydbCreateTable(step.Table, step)
+	case stepAddColumn:
+		if desc == nil && dryRun {
+			return "", nil // table is created by pending migration
+		}
+		if desc == nil {
+			return "", fmt.Errorf("no table %s", step.Table)
+		}
+		columns := make([]string, 0, len(step.Columns))
+		for _, c := range step.Columns {
+			if !hasColumn(c.Name) {
+				columns = append(columns, fmt.Sprintf("ADD COLUMN %s %s", c.Name, ydbColumnTypes[c.Type]))
+			}
+		}
+		if len(columns) == 0 {
+			return "", nil
+		}
+		statement = fmt.Sprintf("ALTER TABLE %s %s", step.Table, strings.Join(columns, ", "))
+	case stepRebuildTable:
+		return s.rebuildTable(ctx, step, desc, dryRun)
+	default:
+		return "", fmt.Errorf("unknown migration step '%s'", step.Kind)
+	}
+
+	if dryRun {
+		return statement, nil
+	}
+	return statement, s.scheme(ctx, statement)
+}
+
+// rebuildTable fills table with new key under temporary name and replaces the old one with it.
+// interrupted rebuild is continued
+func (s *ydbStorage) rebuildTable(ctx context.Context, step MigrationStep, desc *options.Description, dryRun bool) (string, error) {
+	rebuilt := step.Table + rebuildSuffix
+	rebuiltDesc, err := s.describe(ctx, rebuilt)
+	if err != nil {
+		return "", err
+	}
+
+	rename := fmt.Sprintf("ALTER TABLE %s RENAME TO %s", rebuilt, step.Table)
+	switch {
+	case desc == nil && rebuiltDesc != nil:
+		// old table is dropped already
+		if dryRun {
+			return rename, nil
+		}
+		return rename, s.scheme(ctx, rename)
+	case desc == nil && dryRun:
+		return "", nil // table is created by pending migration
+	case desc == nil:
+		return "", fmt.Errorf("no table %s", step.Table)
+	case slices.Equal(desc.PrimaryKey, step.Key):
+		return "", nil
+	}
+
+	names := make([]string, 0, len(step.Columns))
+	values := make([]string, 0, len(step.Columns))
+	for _, c := range step.Columns {
+		names = append(names, c.Name)
+		if slices.ContainsFunc(desc.Columns, func(old options.Column) bool { return old.Name == c.Name }) {
+			values = append(values, c.Name)
+		} else {
+			values = append(values, fmt.Sprintf("CAST(%s AS %s) AS %s", strconv.Quote(step.Value), ydbColumnTypes[c.Type], c.Name))
+		}
+	}
+
+	statements := make([]string, 0, 5)
+	if rebuiltDesc != nil {
+		statements = append(statements, fmt.Sprintf("DROP TABLE %s", rebuilt))
+	}
+	statements = append(statements, ydbCreateTable(rebuilt, step))
+	copyRows := fmt.Sprintf("INSERT INTO %s (%s) SELECT %s FROM %s", rebuilt, strings.Join(names, ", "), strings.Join(values, ", "), step.Table)
+	statements = append(statements, copyRows, fmt.Sprintf("DROP TABLE %s", step.Table), rename)
+
+	statement := strings.Join(statements, ";\n")
+	if dryRun {
+		return statement, nil
+	}
+	for _, st := range statements {
+		if st == copyRows {
+			err = s.write(ctx, "--!syntax_v1\n"+st, nil)
+		} else {
+			err = s.scheme(ctx, st)
+		}
+		if err != nil {
+			return statement, err
+		}
+	}
+	return statement, nil
+}
+
+// read runs read only query and passes every row to scan
+func (s *ydbStorage) read(ctx context.Context, query string, params *table.QueryParameters, scan func(row namedScanner) error) error {
+	return s.db.Table().Do(ctx, func(ctxSession context.Context, session table.Session) (err error) {
+		txc := table.TxControl(
+			table.BeginTx(table.WithOnlineReadOnly()),
+			table.CommitTx(),
+		)
+
+		_, res, err := session.Execute(ctxSession, txc, query, params)
+		if err != nil {
+			return
+		}
+		defer res.Close()
+
+		for res.NextResultSet(ctxSession) {
+			for res.NextRow() {
+				err := scan(res)
+				if err != nil {
+					fmt.Printf("error parsing row. %v", err)
+				}
+			}
+		}
+		return res.Err()
+	})
+}
+
+// write runs query in read-write transaction
+func (s *ydbStorage) write(ctx context.Context, query string, params *table.QueryParameters) error {
+	return s.db.Table().Do(ctx, func(ctxSession context.Context, session table.Session) (err error) {
+		txc := table.TxControl(
+			table.BeginTx(table.WithSerializableReadWrite()),
+			table.CommitTx(),
+		)
+
+		_, _, err = session.Execute(ctxSession, txc, query, params)
+		return
+	})
+}
+
+func (s *ydbStorage) Games(ctx context.Context) ([]Game, error) {
+	games := make([]Game, 0)
+	err := s.read(ctx,
+		`--!syntax_v1
+		SELECT id, name FROM games
+		`,
+		nil,
+		func(row namedScanner) error {
+			var game Game
+			err := row.ScanNamed(
+				named.OptionalWithDefault("id", &game.Id),
+				named.OptionalWithDefault("name", &game.Name))
+			if err == nil {
+				games = append(games, game)
+			}
+			return err
+		},
+	)
+	return games, err
+}
+
+func (s *ydbStorage) Cookies(ctx context.Context, account string, domain string) ([]Cookie, error) {
+	query := `--!syntax_v1
+		DECLARE $account AS Utf8;
+		DECLARE $domain AS String;
+
+		SELECT name, value, domain, path FROM account_cookies WHERE account = $account AND domain LIKE $domain
+		`
+	if account == defaultAccount {
+		query = `--!syntax_v1
+		DECLARE $account AS Utf8;
+		DECLARE $domain AS String;
+
+		SELECT name, value, domain, path FROM cookies WHERE domain LIKE $domain
+		`
+	}
+
+	cookies := make([]Cookie, 0)
+	err := s.read(ctx, query,
+		table.NewQueryParameters(
+			table.ValueParam("$account", types.UTF8Value(account)),
+			table.ValueParam("$domain", types.StringValueFromString("%"+domain+"%")),
+		),
+		func(row namedScanner) error {
+			var c Cookie
+			err := row.ScanNamed(
+				named.OptionalWithDefault("name", &c.Name),
+				named.OptionalWithDefault("value", &c.Value),
+				named.OptionalWithDefault("domain", &c.Domain),
+				named.OptionalWithDefault("path", &c.Path))
+			if err == nil {
+				cookies = append(cookies, c)
+			}
+			return err
+		},
+	)
+	return cookies, err
+}
+
+func (s *ydbStorage) Accounts(ctx context.Context) ([]Account, error) {
+	accounts := make([]Account, 0)
+	err := s.read(ctx,
+		`--!syntax_v1
+		SELECT name, profile, steam_key, points_reserve, settings FROM accounts
+		`,
+		nil,
+		func(row namedScanner) error {
+			var a Account
+			var reserve int64
+			err := row.ScanNamed(
+				named.OptionalWithDefault("name", &a.Name),
+				named.OptionalWithDefault("profile", &a.SteamProfile),
+				named.OptionalWithDefault("steam_key", &a.SteamAPIKey),
+				named.OptionalWithDefault("points_reserve", &reserve),
+				named.OptionalWithDefault("settings", &a.Settings))
+			if err == nil {
+				a.PointsReserve = int(reserve)
+				accounts = append(accounts, a)
+			}
+			return err
+		},
+	)
+	return accounts, err
+}
+
+func (s *ydbStorage) Entries(ctx context.Context, account string, ends int64) ([]Entry, error) {
+	entries := make([]Entry, 0)
+	err := s.read(ctx,
+		`--!syntax_v1
+		DECLARE $account AS Utf8;
+		DECLARE $now AS Int64;
+
+		SELECT sgid, gid, points, time, ends, result FROM entries WHERE account = $account AND ends >= $now
+		`,
+		table.NewQueryParameters(
+			table.ValueParam("$account", types.UTF8Value(account)),
+			table.ValueParam("$now", types.Int64Value(ends)),
+		),
+		func(row namedScanner) error {
+			var e Entry
+			var points int64
+			err := row.ScanNamed(
+				named.OptionalWithDefault("sgid", &e.SGID),
+				named.OptionalWithDefault("gid", &e.GID),
+				named.OptionalWithDefault("points", &points),
+				named.OptionalWithDefault("time", &e.Time),
+				named.OptionalWithDefault("ends", &e.Ends),
+				named.OptionalWithDefault("result", &e.Result))
+			if err == nil {
+				e.Points = int(points)
+				entries = append(entries, e)
+			}
+			return err
+		},
+	)
+	return entries, err
+}
+
+func (s *ydbStorage) SaveEntries(ctx context.Context, account string, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	rows := make([]types.Value, 0, len(entries))
+	for _, e := range entries {
+		rows = append(rows, types.StructValue(
+			types.StructFieldValue("account", types.UTF8Value(account)),
+			types.StructFieldValue("sgid", types.UTF8Value(e.SGID)),
+			types.StructFieldValue("gid", types.Uint64Value(e.GID)),
+			types.StructFieldValue("points", types.Int64Value(int64(e.Points))),
+			types.StructFieldValue("time", types.Int64Value(e.Time)),
+			types.StructFieldValue("ends", types.Int64Value(e.Ends)),
+			types.StructFieldValue("result", types.UTF8Value(e.Result)),
+		))
+	}
+
+	return s.write(ctx,
+		`--!syntax_v1
+		DECLARE $entries AS List<Struct<
+			account: Utf8,
+			sgid: Utf8,
+			gid: Uint64,
+			points: Int64,
+			time: Int64,
+			ends: Int64,
+			result: Utf8>>;
+
+		UPSERT INTO entries
+		SELECT account, sgid, gid, points, time, ends, result FROM AS_TABLE($entries);
+		`,
+		table.NewQueryParameters(table.ValueParam("$entries", types.ListValue(rows...))),
+	)
+}
+
+func (s *ydbStorage) State(ctx context.Context, name string) (string, error) {
+	var raw string
+	err := s.read(ctx,
+		`--!syntax_v1
+		DECLARE $name AS Utf8;
+
+		SELECT value FROM state WHERE name = $name
+		`,
+		table.NewQueryParameters(table.ValueParam("$name", types.UTF8Value(name))),
+		func(row namedScanner) error {
+			return row.ScanNamed(named.OptionalWithDefault("value", &raw))
+		},
+	)
+	return raw, err
+}
+
+func (s *ydbStorage) SaveState(ctx context.Context, name string, value string) error {
+	return s.write(ctx,
+		`--!syntax_v1
+		DECLARE $name AS Utf8;
+		DECLARE $value AS Utf8;
+
+		REPLACE INTO state (name, value) VALUES ($name, $value);
+		`,
+		table.NewQueryParameters(
+			table.ValueParam("$name", types.UTF8Value(name)),
+			table.ValueParam("$value", types.UTF8Value(value)),
+		),
+	)
+}
+
+func (s *ydbStorage) AddDigest(ctx context.Context, events []DigestEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	rows := make([]types.Value, 0, len(events))
+	for _, e := range events {
+		rows = append(rows, types.StructValue(
+			types.StructFieldValue("id", types.UTF8Value(e.ID)),
+			types.StructFieldValue("time", types.Int64Value(e.Time)),
+			types.StructFieldValue("source", types.UTF8Value(e.Source)),
+			types.StructFieldValue("account", types.UTF8Value(e.Account)),
+			types.StructFieldValue("kind", types.UTF8Value(e.Kind)),
+			types.StructFieldValue("payload", types.UTF8Value(e.PayloadJSON())),
+			types.StructFieldValue("text", types.UTF8Value(e.Text)),
+		))
+	}
+
+	return s.write(ctx,
+		`--!syntax_v1
+		DECLARE $events AS List<Struct<
+			id: Utf8,
+			time: Int64,
+			source: Utf8,
+			account: Utf8,
+			kind: Utf8,
+			payload: Utf8,
+			text: Utf8>>;
+
+		UPSERT INTO digest_events
+		SELECT id, time, source, account, kind, payload, text FROM AS_TABLE($events);
+		`,
+		table.NewQueryParameters(table.ValueParam("$events", types.ListValue(rows...))),
+	)
+}
+
+func (s *ydbStorage) ClaimDigest(ctx context.Context, claim string, now int64) ([]DigestEvent, error) {
+	// messages of old versions are moved to events
+	err := s.write(ctx,
+		`--!syntax_v1
+		DECLARE $kind AS Utf8;
+
+		UPSERT INTO digest_events (id, time, source, account, kind, payload, text)
+		SELECT "message:"u || message AS id, CAST(0 AS Int64) AS time, ""u AS source, ""u AS account,
+			$kind AS kind, "{}"u AS payload, message AS text FROM digest;
+		DELETE FROM digest;
+		`,
+		table.NewQueryParameters(table.ValueParam("$kind", types.UTF8Value(eventMessage))),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]DigestEvent, 0)
+	err = s.db.Table().Do(ctx, func(ctxSession context.Context, session table.Session) (err error) {
+		events = events[:0]
+
+		// read not sent events and claim them in one transaction
+		tx, res, err := session.Execute(ctxSession,
+			table.TxControl(table.BeginTx(table.WithSerializableReadWrite())),
+			`--!syntax_v1
+			DECLARE $expired AS Int64;
+
+			SELECT id, time, source, account, kind, payload, text FROM digest_events
+			WHERE sent IS NULL AND (claim IS NULL OR claimed < $expired)
+			`,
+			table.NewQueryParameters(table.ValueParam("$expired", types.Int64Value(claimExpired(now)))),
+		)
+		if err != nil {
+			return
+		}
+		claims := make([]types.Value, 0)
+		for res.NextResultSet(ctxSession) {
+			for res.NextRow() {
+				var e DigestEvent
+				var payload string
+				err := res.ScanNamed(
+					named.OptionalWithDefault("id", &e.ID),
+					named.OptionalWithDefault("time", &e.Time),
+					named.OptionalWithDefault("source", &e.Source),
+					named.OptionalWithDefault("account", &e.Account),
+					named.OptionalWithDefault("kind", &e.Kind),
+					named.OptionalWithDefault("payload", &payload),
+					named.OptionalWithDefault("text", &e.Text))
+				if err != nil {
+					fmt.Println("error parsing digest row.", err)
+					continue
+				}
+				e.Payload = parsePayload(payload)
+				events = append(events, e)
+				claims = append(claims, types.StructValue(
+					types.StructFieldValue("id", types.UTF8Value(e.ID)),
+					types.StructFieldValue("claim", types.UTF8Value(claim)),
+					types.StructFieldValue("claimed", types.Int64Value(now)),
+				))
+			}
+		}
+		res.Close()
+
+		if len(claims) == 0 {
+			_, err = tx.CommitTx(ctxSession)
+			return
+		}
+		_, _, err = session.Execute(ctxSession,
+			table.TxControl(table.WithTx(tx), table.CommitTx()),
+			`--!syntax_v1
+			DECLARE $claims AS List<Struct<
+				id: Utf8,
+				claim: Utf8,
+				claimed: Int64>>;
+
+			UPDATE digest_events ON
+			SELECT id, claim, claimed FROM AS_TABLE($claims);
+			`,
+			table.NewQueryParameters(table.ValueParam("$claims", types.ListValue(claims...))),
+		)
+		return
+	})
+	return events, err
+}
+
+func (s *ydbStorage) ReleaseDigest(ctx context.Context, claim string) error {
+	return s.write(ctx,
+		`--!syntax_v1
+		DECLARE $claim AS Utf8;
+
+		UPDATE digest_events SET claim = NULL, claimed = NULL WHERE claim = $claim AND sent IS NULL;
+		`,
+		table.NewQueryParameters(table.ValueParam("$claim", types.UTF8Value(claim))),
+	)
+}
+
+func (s *ydbStorage) MarkDigestSent(ctx context.Context, claim string, now int64) error {
+	err := s.write(ctx,
+		`--!syntax_v1
+		DECLARE $claim AS Utf8;
+		DECLARE $now AS Int64;
+
+		UPDATE digest_events SET sent = $now WHERE claim = $claim AND sent IS NULL;
+		`,
+		table.NewQueryParameters(
+			table.ValueParam("$claim", types.UTF8Value(claim)),
+			table.ValueParam("$now", types.Int64Value(now)),
+		),
+	)
+	if err != nil {
+		return err
+	}
+
+	return s.write(ctx,
+		`--!syntax_v1
+		DECLARE $expired AS Int64;
+
+		DELETE FROM digest_events WHERE sent < $expired;
+		`,
+		table.NewQueryParameters(table.ValueParam("$expired", types.Int64Value(sentExpired(now)))),
+	)
+}
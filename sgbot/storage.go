@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+const (
+	storageYDB    string = "ydb"
+	storageSQLite string = "sqlite"
+	storageJSON   string = "json"
+)
+
+// Storage keeps bot data between runs: whitelist, cookies, accounts, entries, state and digest
+type Storage interface {
+	// tables (files) for bot data are created and changed with migrations
+	Migrator
+
+	// Games manual whitelist
+	Games(ctx context.Context) ([]Game, error)
+	// Cookies of the account which domain contains domain. default account has own cookies table
+	Cookies(ctx context.Context, account string, domain string) ([]Cookie, error)
+	// Accounts besides the default one
+	Accounts(ctx context.Context) ([]Account, error)
+
+	// Entries of the account for giveaways which end after ends (unix time)
+	Entries(ctx context.Context, account string, ends int64) ([]Entry, error)
+	SaveEntries(ctx context.Context, account string, entries []Entry) error
+
+	// State document by name, empty - no state yet
+	State(ctx context.Context, name string) (string, error)
+	SaveState(ctx context.Context, name string, value string) error
+
+	// digest is delivered at least once: events are claimed by delivery attempt and marked sent after it succeeds.
+	// claim of failed attempt is released or expires after digestClaimTimeout
+	AddDigest(ctx context.Context, events []DigestEvent) error
+	// ClaimDigest marks not sent events (not claimed or with expired claim) with claim and returns them
+	ClaimDigest(ctx context.Context, claim string, now int64) ([]DigestEvent, error)
+	// ReleaseDigest returns claimed events to digest
+	ReleaseDigest(ctx context.Context, claim string) error
+	// MarkDigestSent marks claimed events as sent, sent events are removed after digestKeep
+	MarkDigestSent(ctx context.Context, claim string, now int64) error
+
+	Close(ctx context.Context) error
+}
+
+const (
+	digestClaimTimeout = 15 * time.Minute
+	digestKeep         = 30 * 24 * time.Hour
+)
+
+// claimExpired claims made before it are expired
+func claimExpired(now int64) int64 {
+	return now - int64(digestClaimTimeout.Seconds())
+}
+
+// sentExpired events sent before it are removed
+func sentExpired(now int64) int64 {
+	return now - int64(digestKeep.Seconds())
+}
+
+// StorageConfig selects storage implementation
+type StorageConfig struct {
+	Kind     string // ydb (default), sqlite or json
+	Path     string // sqlite database file or json files directory
+	Database string // ydb database
+}
+
+// storageOpeners storage implementations by kind (sqlite is added by build with 'sqlite' tag)
+var storageOpeners = map[string]func(ctx context.Context, cfg StorageConfig) (Storage, error){
+	storageYDB:  openYDBStorage,
+	storageJSON: openJSONStorage,
+}
+
+// storageConfig reads storage settings from environment
+func storageConfig() StorageConfig {
+	return StorageConfig{
+		Kind:     os.Getenv("SG_STORAGE"),
+		Path:     os.Getenv("SG_STORAGE_PATH"),
+		Database: os.Getenv("YDB_DATABASE"),
+	}
+}
+
+func openStorage(ctx context.Context, cfg StorageConfig) (Storage, error) {
+	kind := cfg.Kind
+	if kind == "" {
+		kind = storageYDB
+	}
+
+	open, ok := storageOpeners[kind]
+	if !ok {
+		return nil, &BotError{When: time.Now(), What: fmt.Sprintf("unknown storage '%s'", kind), Err: ErrMisconfigured}
+	}
+	if kind != storageYDB && cfg.Path == "" {
+		return nil, &BotError{When: time.Now(), What: fmt.Sprintf("%s storage requires path", kind), Err: ErrMisconfigured}
+	}
+	return open(ctx, cfg)
+}
@@ -8,63 +8,101 @@ import (
 	"fmt"
 	"io"
 	"log"
-	"maps"
-	"math/rand"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
-	scraperapi "github.com/zenrows/zenrows-go-sdk/service/api"
 )
 
 var stdlog, errlog *log.Logger
 
-// BotError Description of BOT error
+// BotError Description of BOT error. Err is a kind of failure (ErrAuthExpired, etc) if it's known
 type BotError struct {
 	When time.Time
 	What string
+	Err  error
 }
 
 func (e *BotError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("at %v, %v: %s", e.When, e.Err, e.What)
+	}
 	return fmt.Sprintf("at %v, %s", e.When, e.What)
 }
 
+func (e *BotError) Unwrap() error {
+	return e.Err
+}
+
 // GiveAway Definition of GA
 type GiveAway struct {
-	SGID string
-	GID  uint64
-	URL  string
-	Name string
-	Time time.Time
+	SGID    string
+	GID     uint64
+	URL     string
+	Name    string
+	Time    time.Time // end time
+	Points  int
+	Copies  int
+	Entries int
+	Level   int // contributor level required
+	Creator string
+	Created time.Time
+	Entered bool     // already entered (faded row)
+	Apps    int      // apps in package (sub giveaway), 0 - single game
+	Primary uint64   // primary (first listed) app of package
+	Matched []uint64 // whitelisted apps of package
 }
 
 // {"type":"success","entry_count":"108","points":"147"}
+// {"type":"error","msg":"Not Enough Points"}
 type postResponse struct {
 	Type    string `json:"type"`
+	Msg     string `json:"msg"`
 	Entries string `json:"entry_count"`
 	Points  string `json:"points"`
 }
 
 const (
-	baseURL             string = "https://www.steamgifts.com"
-	sgWishlistURL       string = "/giveaways/search?type=wishlist"
-	sgAccountInfo       string = "/giveaways/won"
-	steamProfileURL     string = "https://steamcommunity.com/profiles/%s/followedgames/"
+	baseURL       string = "https://www.steamgifts.com"
+	sgSearchURL   string = "/giveaways/search"
+	sgWishlistURL string = "/giveaways/search?type=wishlist"
+	sgAccountInfo string = "/giveaways/won"
+)
+
+const (
+	// time to finish the run after the last entry (persist digest, entries, etc)
+	finishTimeReserve time.Duration = 10 * time.Second
+	steamTimeout      time.Duration = 15 * time.Second
 )
 
+// timeIsOver - run has to finish, what is left of it is reserved to persist results
+func timeIsOver(ctx context.Context) bool {
+	deadline, ok := ctx.Deadline()
+	return ok && time.Until(deadline) < finishTimeReserve
+}
+
+func steamGet(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
 type ApiResponse[T any] struct {
 	Resp T	`json:"response"`
 }
 
-func fetchFollowedList(steamID string, apiKey string) (map[uint64]bool, error) {
+func fetchFollowedList(ctx context.Context, client *http.Client, steamID string, apiKey string) (map[uint64]bool, error) {
 	url := fmt.Sprintf("https://api.steampowered.com/IStoreService/GetGamesFollowed/v1/?id=%s&steamid=%s", apiKey, steamID)
 
-	resp, err := http.Get(url)
+	resp, err := steamGet(ctx, client, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed process request: %v", err)
 	}
@@ -72,7 +110,7 @@ func fetchFollowedList(steamID string, apiKey string) (map[uint64]bool, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("unexpected status code: %d: %w", resp.StatusCode, pageStatusKind(resp.StatusCode))
 	}
 
 	answer, err := io.ReadAll(resp.Body)
@@ -87,7 +125,7 @@ func fetchFollowedList(steamID string, apiKey string) (map[uint64]bool, error) {
 	games := ApiResponse[Items]{}
 	err = json.Unmarshal(answer, &games)
 	if err != nil {
-		return nil, fmt.Errorf("failed unmarshall json response: %v", err)
+		return nil, fmt.Errorf("failed unmarshall json response: %v: %w", err, ErrParse)
 	}
 
 	out := make(map[uint64]bool)
@@ -98,10 +136,18 @@ func fetchFollowedList(steamID string, apiKey string) (map[uint64]bool, error) {
 	return out, nil
 }
 
-func fetchWishlist(steamID string, apiKey string) (map[uint64]bool, error) {
+// WishlistItem wishlisted game with its priority
+type WishlistItem struct {
+	AppID     uint64 `json:"appid"`
+	Priority  int    `json:"priority"`
+	DateAdded int64  `json:"date_added"`
+}
+
+// fetchWishlist returns wishlisted games
+func fetchWishlist(ctx context.Context, client *http.Client, steamID string, apiKey string) ([]WishlistItem, error) {
 	url := fmt.Sprintf("https://api.steampowered.com/IWishlistService/GetWishlist/v1?id=%s&steamid=%s", apiKey, steamID)
 
-	resp, err := http.Get(url)
+	resp, err := steamGet(ctx, client, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed process request: %v", err)
 	}
@@ -109,7 +155,7 @@ func fetchWishlist(steamID string, apiKey string) (map[uint64]bool, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("unexpected status code: %d: %w", resp.StatusCode, pageStatusKind(resp.StatusCode))
 	}
 
 	answer, err := io.ReadAll(resp.Body)
@@ -117,32 +163,21 @@ func fetchWishlist(steamID string, apiKey string) (map[uint64]bool, error) {
 		return nil, fmt.Errorf("can't read body: %d", resp.StatusCode)
 	}
 
-	type GameInfo struct {
-		AppID     uint64 `json:"appid"`
-		Priority  int    `json:"priority"`
-		DateAdded int    `json:"added"`
-	}
-
 	type WishlistItems struct {
-		Items []GameInfo	`json:"items"`
+		Items []WishlistItem `json:"items"`
 	}
 
 	games := ApiResponse[WishlistItems]{}
 	err = json.Unmarshal(answer, &games)
 	if err != nil {
-		return nil, fmt.Errorf("failed unmarshall json response: %v", err)
+		return nil, fmt.Errorf("failed unmarshall json response: %v: %w", err, ErrParse)
 	}
 
-	out := make(map[uint64]bool)
-	for _, app := range games.Resp.Items {
-		out[app.AppID] = true
-	}
-
-	return out, nil
+	return games.Resp.Items, nil
 }
 
-func fetchSteamPage(url string) (retDoc *goquery.Document, err error) {
-	resp, err := http.Get(url)
+func fetchSteamPage(ctx context.Context, client *http.Client, url string) (retDoc *goquery.Document, err error) {
+	resp, err := steamGet(ctx, client, url)
 	if err != nil {
 		return nil, fmt.Errorf("failed process request: %v", err)
 	}
@@ -150,7 +185,7 @@ func fetchSteamPage(url string) (retDoc *goquery.Document, err error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, fmt.Errorf("unexpected status code: %d: %w", resp.StatusCode, pageStatusKind(resp.StatusCode))
 	}
 
 	answer, err := io.ReadAll(resp.Body)
@@ -163,142 +198,247 @@ func fetchSteamPage(url string) (retDoc *goquery.Document, err error) {
 
 // TheBot class for work with SteamGifts pages
 type TheBot struct {
-	// client
-	client  *scraperapi.Client
-	cookies []*http.Cookie
+	// client for steamgifts and for steam (api, store)
+	client      Fetcher
+	steamClient *http.Client
 
-	// keys and auth
-	steamID string
+	// keys and auth. vanity name is resolved to steam id with checkProfile
+	steamID     string
+	steamVanity string
 	steamAPIKey string
 
-	// games
-	gamesWhitelist map[uint64]bool
+	// games to enter giveaways for. top wishlist games are entered first
+	gamesWhitelist map[uint64]*WhitelistGame
+	topWishlist    int
+
+	// rules for entering giveaways
+	rules Rules
+
+	// giveaways ranking
+	scorer Scorer
+
+	// listings to check
+	sources []Source
+
+	// pagination limits (0 - no limit)
+	maxPages       int
+	pagesTimeLimit time.Duration
+
+	// direct search for whitelisted games
+	search gameSearch
+
+	// points balance (< 0 - unknown) and points kept for wishlist giveaways which end within reserveWindow
+	points        int
+	pointsReserve int
+	reserveWindow time.Duration
+
+	// pauses and caps for entries
+	pacer *pacer
+
+	// entries made by the bot and how often to check them with steamgifts
+	history           *EntryHistory
+	reconcileInterval time.Duration
+
+	// exclude games shared by steam family members too
+	familySharing bool
+
+	// data kept between runs
+	state *BotState
+
+	// how long resolved steam packages are cached
+	packagesTTL time.Duration
 
 	// digest update
-	digest []string
+	digest []DigestEvent
 }
 
-// InitBot initilize bot fields, load configs
-func (b *TheBot) InitBot(steamProfile string, steamAPIKey string, zenrowsAPIKey string) error {
-	b.steamID = steamProfile
-	b.steamAPIKey = steamAPIKey
-	b.gamesWhitelist = make(map[uint64]bool)
-	b.digest = make([]string, 0)
+// InitBot initilize bot fields, load configs. steam profile is steam id, vanity name or profile url
+func (b *TheBot) InitBot(steamProfile string, steamAPIKey string, fetcher Fetcher) error {
+	if fetcher == nil {
+		return &BotError{When: time.Now(), What: "no page fetcher"}
+	}
 
-	b.client = scraperapi.NewClient(scraperapi.WithAPIKey(zenrowsAPIKey))
+	steamID, vanity, err := parseSteamProfile(steamProfile)
+	if err != nil {
+		return err
+	}
+	if steamAPIKey == "" {
+		return &BotError{When: time.Now(), What: "steam api key empty", Err: ErrMisconfigured}
+	}
+
+	b.steamID = steamID
+	b.steamVanity = vanity
+	b.steamAPIKey = steamAPIKey
+	b.gamesWhitelist = make(map[uint64]*WhitelistGame)
+	b.topWishlist = defaultTopWishlist
+	b.scorer = scorers[defaultScoring]
+	b.digest = make([]DigestEvent, 0)
+	b.state = newBotState()
+	b.packagesTTL = time.Duration(defaultPackagesHours) * time.Hour
+	b.sources = defaultSources()
+	b.points = -1
+	b.reserveWindow = time.Duration(defaultReserveHours) * time.Hour
+	b.history = newEntryHistory(nil)
+	pacing, _ := parsePacing(nil)
+	b.pacer = newPacer(pacing)
+
+	b.client = fetcher
+	b.steamClient = newSteamClient(nil, defaultRetryPolicy())
 
 	return nil
 }
 
-func (b *TheBot) getSteamLists() (err error) {
+func (b *TheBot) getSteamLists(ctx context.Context) (err error) {
 	if b.steamID == "" {
-		return &BotError{time.Now(), "steam profile empty"}
+		return &BotError{When: time.Now(), What: "steam profile empty"}
 	}
 
 	// parse wish list entries
-	wg, err := fetchWishlist(b.steamID, b.steamAPIKey)
+	wl, err := fetchWishlist(ctx, b.steamClient, b.steamID, b.steamAPIKey)
 	if err != nil {
 		stdlog.Println("can't fetch steam wishlist", err)
-		return &BotError{time.Now(), "can't fetch steam wishlist"}
+		return &BotError{When: time.Now(), What: "can't fetch steam wishlist"}
 	}
 
-	stdlog.Println("wishlist entries", len(wg))
-	maps.Copy(b.gamesWhitelist, wg)
+	stdlog.Println("wishlist entries", len(wl))
+	for _, item := range wl {
+		game := b.whitelistGame(item.AppID, listWishlist)
+		game.Priority = item.Priority
+		game.Added = time.Unix(item.DateAdded, 0)
+	}
 
 	// parse followed games entries
-	wg, err = fetchFollowedList(b.steamID, b.steamAPIKey)
+	wg, err := fetchFollowedList(ctx, b.steamClient, b.steamID, b.steamAPIKey)
 	if err != nil {
 		stdlog.Println("can't fetch followed games", err)
-		return &BotError{time.Now(), "can't fetch followed games"}
+		return &BotError{When: time.Now(), What: "can't fetch followed games"}
 	}
 	stdlog.Println("followed entries", len(wg))
-	maps.Copy(b.gamesWhitelist, wg)
+	for gid := range wg {
+		b.whitelistGame(gid, listFollowed)
+	}
 
 	stdlog.Println("steam profile parsed successfully")
 	return nil
 }
 
-func (b *TheBot) postRequest(path string, queryParams url.Values) (status bool, err error) {
+func (b *TheBot) postRequest(ctx context.Context, path string, queryParams url.Values) (r postResponse, err error) {
 	pageURL, err := url.Parse(baseURL + path)
 	if err != nil {
 		return
 	}
 
-	params := &scraperapi.RequestParameters{
-		CustomHeaders: http.Header{
-			"Referer": []string{baseURL},
-			"User-Agent": []string{"Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:153.0) Gecko/20100101 Firefox/153.0"},
-			"Origin": []string{baseURL},
-			"Content-Type": []string{"application/x-www-form-urlencoded; charset=UTF-8"},
-		},
+	resp, err := b.client.Post(ctx, pageURL.String(), queryParams)
+	if err != nil {
+		return
 	}
 
-	for _, k := range b.cookies {
-		if k.Domain != pageURL.Host {
-			continue
-		}
+	stdlog.Println("giveaway post request answer", pageURL.String(), resp.StatusCode, string(resp.Body))
 
-		params.CustomHeaders.Add("Cookie", k.String())
+	if kind := statusKind(resp.StatusCode); kind != nil {
+		// rejected entry is classified by ajax message if there is one
+		if kind == ErrEntryRejected && json.Unmarshal(resp.Body, &r) == nil && r.Msg != "" {
+			kind = messageKind(r.Msg)
+		}
+		return r, &BotError{When: time.Now(), What: fmt.Sprintf("status %d (%s)", resp.StatusCode, resp.Body), Err: kind}
 	}
 
-	resp, err := b.client.Post(
-		context.Background(),
-		pageURL.String(),
-		params,
-		queryParams.Encode())
+	err = json.Unmarshal(resp.Body, &r)
 	if err != nil {
-		return
+		return r, &BotError{When: time.Now(), What: err.Error(), Err: ErrParse}
 	}
 
-	stdlog.Println("giveaway post request answer", pageURL.String(), resp.StatusCode(), string(resp.Body()))
-
-	r := postResponse{}
-
-	if resp.StatusCode() == http.StatusOK {
-		err = json.Unmarshal(resp.Body(), &r)
-		return r.Type == "success", err
-	} else if resp.StatusCode() == http.StatusUnprocessableEntity {
-		stdlog.Printf("internal error (%s)", resp.Body())
-		return true, nil
-	} else {
-		return false, nil
+	if r.Type != "success" {
+		return r, &BotError{When: time.Now(), What: r.Msg, Err: messageKind(r.Msg)}
 	}
+
+	return r, nil
 }
 
-func (b *TheBot) getPageCustom(uri string) (retDoc *goquery.Document, err error) {
+func (b *TheBot) getPageCustom(ctx context.Context, uri string) (retDoc *goquery.Document, err error) {
 	pageURL, err := url.Parse(uri)
 	if err != nil {
 		return
 	}
 
-	params := &scraperapi.RequestParameters{
-		JSRender:          true,
-		WaitForSelector:   "body",
-		CustomHeaders:     http.Header{},
+	resp, err := b.client.Get(ctx, pageURL.String())
+	if err != nil {
+		return
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &BotError{When: time.Now(), What: fmt.Sprintf("unexpected status code %d for %s", resp.StatusCode, pageURL.String()), Err: pageStatusKind(resp.StatusCode)}
 	}
 
-	for _, k := range b.cookies {
-		if k.Domain != pageURL.Host {
-			continue
-		}
+	return goquery.NewDocumentFromReader(bytes.NewReader(resp.Body))
+}
 
-		params.CustomHeaders.Add("Cookie", k.String())
+func (b *TheBot) parseToken(str string) string {
+	return str[len(str)-32:]
+}
+
+func (b *TheBot) setCookies(cookies []*http.Cookie) {
+	b.client.SetCookies(cookies)
+}
+
+func (b *TheBot) setSteamClient(client *http.Client) {
+	b.steamClient = client
+}
+
+func (b *TheBot) setState(state *BotState) {
+	if state != nil {
+		b.state = state
 	}
+}
+
+func (b *TheBot) setSources(sources []Source) {
+	b.sources = sources
+}
 
-	resp, err := b.client.Get(context.Background(), pageURL.String(), params)
+func (b *TheBot) setScoring(name string) error {
+	scorer, err := getScorer(name)
 	if err != nil {
-		return
+		return err
 	}
+	b.scorer = scorer
+	return nil
+}
 
-	return goquery.NewDocumentFromReader(bytes.NewReader(resp.Body()))
+func (b *TheBot) setPointsReserve(reserve int, window time.Duration) {
+	b.pointsReserve = reserve
+	b.reserveWindow = window
 }
 
-func (b *TheBot) parseToken(str string) string {
-	return str[len(str)-32:]
+func (b *TheBot) setHistory(history *EntryHistory, reconcileInterval time.Duration) {
+	if history != nil {
+		b.history = history
+	}
+	b.reconcileInterval = reconcileInterval
 }
 
-func (b *TheBot) setCookies(cookies []*http.Cookie) {
-	b.cookies = cookies
+func (b *TheBot) setTopWishlist(top int) {
+	b.topWishlist = top
+}
+
+func (b *TheBot) setRules(rules Rules) {
+	b.rules = rules
+}
+
+func (b *TheBot) setFamilySharing(familySharing bool) {
+	b.familySharing = familySharing
+}
+
+func (b *TheBot) setPackagesTTL(ttl time.Duration) {
+	b.packagesTTL = ttl
+}
+
+func (b *TheBot) setPacing(pacing Pacing) {
+	b.pacer = newPacer(pacing)
+}
+
+func (b *TheBot) setPagination(maxPages int, timeLimit time.Duration) {
+	b.maxPages = maxPages
+	b.pagesTimeLimit = timeLimit
 }
 
 func (b *TheBot) getToken(doc *goquery.Document) (token string, err error) {
@@ -309,196 +449,469 @@ func (b *TheBot) getToken(doc *goquery.Document) (token string, err error) {
 	}
 
 	if userName == "" || token == "" {
-		return "", &BotError{time.Now(), "no user information. please refresh cookies or parser"}
+		return "", &BotError{When: time.Now(), What: "no user information. please refresh cookies or parser", Err: ErrAuthExpired}
 	}
 
 	return token, nil
 }
 
-func (b *TheBot) enterGiveaway(game GiveAway, token string) (status bool, err error) {
+// updatePoints reads current points balance from page header
+func (b *TheBot) updatePoints(doc *goquery.Document) {
+	p, err := strconv.Atoi(strings.TrimSpace(doc.Find("span.nav__points").First().Text()))
+	if err != nil {
+		errlog.Println("can't parse points balance", err)
+		return
+	}
+	b.points = p
+}
+
+// affordable checks the balance allows to enter the giveaway. reserve is spent for wishlist games which end soon only
+func (b *TheBot) affordable(game GiveAway) bool {
+	if b.points < 0 {
+		return true
+	}
+
+	limit := b.points
+	if !b.inWishlist(game) || time.Until(game.Time) > b.reserveWindow {
+		limit -= b.pointsReserve
+	}
+	return game.Points <= limit
+}
+
+// inWishlist the game or whitelisted app of the package is wishlisted
+func (b *TheBot) inWishlist(game GiveAway) bool {
+	for _, gid := range append([]uint64{game.GID}, game.Matched...) {
+		if g, ok := b.gamesWhitelist[gid]; ok && slices.Contains(g.Lists, listWishlist) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *TheBot) enterGiveaway(ctx context.Context, game GiveAway, token string) (r postResponse, err error) {
 	params := url.Values{}
 	params.Add("xsrf_token", token)
 	params.Add("code", game.SGID)
 	params.Add("do", "entry_insert")
 
-	return b.postRequest("/ajax.php", params)
+	return b.postRequest(ctx, "/ajax.php", params)
 }
 
-func (b *TheBot) getGiveaways(doc *goquery.Document) (giveaways []GiveAway) {
-	re := regexp.MustCompile(`[0-9]+`)
-	doc.Find("div.giveaway__row-outer-wrap").Each(func(idx int, s *goquery.Selection) {
-		sgCode, _ := s.Find("a.giveaway__heading__name").First().Attr("href")
-		sgCode = strings.Split(sgCode, "/")[2]
+var reNumber = regexp.MustCompile(`[0-9][0-9,]*`)
 
-		game := s.Find("a.giveaway__heading__name").First().Text()
+// parseNumber gets first number from text like "1,234 entries" or "(3 Copies)"
+func parseNumber(text string) (n int, ok bool) {
+	m := reNumber.FindString(text)
+	if m == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(strings.ReplaceAll(m, ",", ""))
+	return n, err == nil
+}
 
-		x, ok := s.Find("a.giveaway__icon[target='_blank']").First().Attr("href")
+// parseGiveawayRow reads giveaway metadata from listing row (steam game id isn't resolved)
+func parseGiveawayRow(s *goquery.Selection) (ga GiveAway, ok bool) {
+	// get steamgifts giveaway code (unique url)
+	ga.URL, ok = s.Find("a.giveaway__heading__name").First().Attr("href")
+	if !ok {
+		errlog.Println("skip giveaway - can't find url")
+		return
+	}
+
+	parts := strings.Split(ga.URL, "/")
+	if len(parts) < 3 {
+		errlog.Println("skip giveaway - unexpected url", ga.URL)
+		return ga, false
+	}
+	ga.SGID = parts[2]
+	ga.Name = s.Find("a.giveaway__heading__name").First().Text()
+
+	// get giveaway timestamps: end time and creation time
+	stamps := s.Find("span[data-timestamp]")
+	y, ok := stamps.First().Attr("data-timestamp")
+	if !ok {
+		errlog.Println("can't parse timestamp for", ga.SGID)
+		return
+	}
+	t, _ := strconv.ParseInt(y, 10, 64)
+	ga.Time = time.Unix(t, 0)
+
+	if y, ok := stamps.Eq(1).Attr("data-timestamp"); ok {
+		t, _ := strconv.ParseInt(y, 10, 64)
+		ga.Created = time.Unix(t, 0)
+	}
+
+	// get giveaway cost and copies, like "(3 Copies)" "(15P)"
+	ga.Copies = 1
+	s.Find("span.giveaway__heading__thin").Each(func(_ int, h *goquery.Selection) {
+		text := h.Text()
+		n, ok := parseNumber(text)
 		if !ok {
-			errlog.Println("no link?", sgCode)
 			return
 		}
+		if strings.HasSuffix(strings.TrimSpace(text), "P)") {
+			ga.Points = n
+		} else if strings.Contains(text, "Cop") {
+			ga.Copies = n
+		}
+	})
+
+	ga.Entries, _ = parseNumber(s.Find("div.giveaway__links a[href$='/entries'] span").First().Text())
+	ga.Level, _ = parseNumber(s.Find("div.giveaway__column--contributor-level").First().Text())
+	ga.Creator = strings.TrimSpace(s.Find("a.giveaway__username").First().Text())
+	ga.Entered = s.Find("div.giveaway__row-inner-wrap").HasClass("is-faded")
 
-		// get steamgifts giveaway code (unique url)
-		sgURL, ok := s.Find("a.giveaway__heading__name").First().Attr("href")
+	return ga, true
+}
+
+// reAppID steam app id in store link of giveaway
+var reAppID = regexp.MustCompile(`[0-9]+`)
+
+func (b *TheBot) getGiveaways(ctx context.Context, doc *goquery.Document) (giveaways []GiveAway) {
+	doc.Find("div.giveaway__row-outer-wrap").Each(func(idx int, s *goquery.Selection) {
+		ga, ok := parseGiveawayRow(s)
 		if !ok {
-			errlog.Println("skip giveaway - can't find url", sgCode)
 			return
 		}
 
-		// get giveaway timestamp
-		y, ok := s.Find("span[data-timestamp]").First().Attr("data-timestamp")
+		x, ok := s.Find("a.giveaway__icon[target='_blank']").First().Attr("href")
 		if !ok {
-			errlog.Println("can't parse timestamp for", sgCode)
+			errlog.Println("no link?", ga.SGID)
 			return
 		}
 
-		t, _ := strconv.ParseInt(y, 10, 64)
-
-		if strings.Contains(x, "/sub/") { // parse sub page
+		if strings.Contains(x, "/sub/") { // resolve package apps
 			stdlog.Println("parse 'sub' giveaway", x)
-			subDoc, err := fetchSteamPage(x)
+			apps, err := b.resolvePackage(ctx, x)
 			if err != nil {
-				errlog.Println("can't get page", x)
+				errlog.Println("can't resolve package", x, err)
 				return
 			}
 
-			subDoc.Find("div.tab_item").EachWithBreak(func(subIdx int, subs *goquery.Selection) bool {
-				subID, subOk := subs.Attr("data-ds-appid")
-				if !subOk {
-					return true
-				}
-
-				gid, _ := strconv.ParseUint(subID, 10, 64)
-
-				_, ok := b.gamesWhitelist[gid]
-				if !ok {
-					// stdlog.Println("skip giveaway by whitelist", gid)
-					return true
+			ga.Apps = len(apps)
+			if len(apps) > 0 {
+				ga.Primary = apps[0]
+			}
+			for _, gid := range apps {
+				if _, ok := b.gamesWhitelist[gid]; ok {
+					ga.Matched = append(ga.Matched, gid)
 				}
+			}
+			if len(ga.Matched) == 0 {
+				return
+			}
 
-				// add nanoseconds to split giveaways which will be ended at one time
-				giveaways = append(giveaways, GiveAway{sgCode, gid, sgURL, game, time.Unix(t, 0)})
-				// stop parse sub page - we're decided to be in!
-				return false
-			})
+			// the first whitelisted app represents the package
+			ga.GID = ga.Matched[0]
+			giveaways = append(giveaways, ga)
 		} else { // parse single game GA
 			// get steam game id and check it whitelisted
-			strgid := re.FindAllString(x, -1)
+			strgid := reAppID.FindAllString(x, -1)
 			if len(strgid) == 0 {
 				stdlog.Println("skip giveaway - can't find steam id", x)
 				return
 			}
 			gid, _ := strconv.ParseUint(strgid[0], 10, 64)
-			// stdlog.Println(gid)
-			_, ok := b.gamesWhitelist[gid]
-			if !ok {
-				// stdlog.Println("skip giveaway by whitelist", gid)
+			wg, ok := b.gamesWhitelist[gid]
+			if ok && wg.Name == "" {
+				wg.Name = ga.Name
+			}
+			if !ok && !b.rules.mayInclude(gid, ga.Name) {
 				return
 			}
 
-			// add nanoseconds to split giveaways which will be ended at one time
-			giveaways = append(giveaways, GiveAway{sgCode, gid, sgURL, game, time.Unix(t, 0)})
+			ga.GID = gid
+			giveaways = append(giveaways, ga)
 		}
 	})
 
-	// stdlog.Println(giveaways)
 	return giveaways
 }
 
-func (b *TheBot) processGiveaways(giveaways []GiveAway, token string, period time.Duration) (entries int) {
+func (b *TheBot) processGiveaways(ctx context.Context, src Source, giveaways []GiveAway, token string) (entries int) {
 	if len(giveaways) == 0 {
 		return
 	}
 
-	// sort giveaways by time asc
-	sec := func(t1, t2 *GiveAway) bool {
-		return t1.Time.UnixNano() < t2.Time.UnixNano()
-	}
-	By(sec).sortGAs(giveaways)
+	// enter the best giveaways first
+	b.rankGiveaways(giveaways)
 
-	timeNow := time.Now().Add(period)
+	timeNow := time.Now().Add(src.window)
 	for _, game := range giveaways {
 		if game.Time.After(timeNow) {
-			stdlog.Println("enough parsing", game)
-			break
+			stdlog.Println("skip - ends out of window", game.SGID, game.Name)
+			continue
 		}
 
-		// add some human behaviour - pause bot for a few seconds (1-3)
-		d := time.Second * time.Duration(rand.Intn(3) + 1)
-		if game.Time.After(time.Now().Add(d)) {
-			time.Sleep(d)
+		if game.Entered || b.history.entered(game.SGID) {
+			stdlog.Println("skip - already entered", game.SGID, game.Name)
+			continue
 		}
 
-		status, err := b.enterGiveaway(game, token)
-		if err != nil {
-			stdlog.Printf("internal error (%s) when enter for [%+v]", err, game)
+		wg, whitelisted := b.gamesWhitelist[game.GID]
+		var lists []string
+		if whitelisted {
+			lists = wg.Lists
+		}
+		if ok, rule := b.rules.decide(game, src.Type, lists, whitelisted, time.Now()); !ok {
+			if rule != nil {
+				stdlog.Printf("skip [%+v] - excluded by rule '%s'\n", game, rule.Title)
+			}
 			continue
 		}
-		if !status {
-			stdlog.Printf("external error when enter for [%+v]. wait\n", game)
+
+		if !src.Bundle.allows(game) {
+			stdlog.Printf("skip [%+v] - not enough whitelisted apps in bundle\n", game)
+			continue
+		}
+
+		if !b.affordable(game) {
+			stdlog.Printf("skip [%+v] - can't afford (%dP left, %dP reserved)\n", game, b.points, b.pointsReserve)
+			continue
+		}
+
+		if timeIsOver(ctx) {
+			stdlog.Println("no time left for entries. stop")
+			break
+		}
+
+		if b.pacer.capped(b.state.Recent, time.Now()) {
+			stdlog.Println("entries cap is reached. stop")
 			break
 		}
+
+		// add some human behaviour - pause bot before entry
+		d, ok := b.pacer.delay(game, time.Now())
+		if !ok {
+			stdlog.Printf("skip [%+v] - ends before pause %v is over\n", game, d)
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			stdlog.Println("run is cancelled. stop")
+			return entries
+		case <-time.After(d):
+		}
+
+		r, err := b.enterGiveaway(ctx, game, token)
+		if p, err := strconv.Atoi(r.Points); err == nil {
+			b.points = p
+		} else if r.Type == "success" && b.points >= 0 {
+			b.points -= game.Points
+		}
+
+		var botErr *BotError
+		switch {
+		case err == nil:
+		case errors.Is(err, ErrAlreadyEntered):
+			stdlog.Printf("already entered [%+v]\n", game)
+			b.recordEntry(game, entryEntered)
+			continue
+		case !errors.As(err, &botErr):
+			stdlog.Printf("internal error (%s) when enter for [%+v]", err, game)
+			b.recordEntry(game, entryFailed)
+			continue
+		default:
+			b.recordEntry(game, entryFailed)
+			kind := eventError
+			if errors.Is(err, ErrAuthExpired) {
+				kind = eventAuthExpired
+			}
+			b.addEvent(kind, map[string]any{
+				"source": src.Type, "sgid": game.SGID, "gid": game.GID, "name": game.Name, "points": game.Points,
+				"error": fmt.Sprint(botErr.Err), "what": botErr.What,
+			}, fmt.Sprintf("[%s] Can't enter %d : %s (%dP). %v: %s", src.Type, game.GID, game.Name, game.Points, botErr.Err, botErr.What))
+			if fatalEntryError(err) {
+				stdlog.Printf("external error (%s) when enter for [%+v]. wait\n", err, game)
+				return entries
+			}
+			stdlog.Printf("can't enter (%s) for [%+v]. skip\n", err, game)
+			continue
+		}
+		b.recordEntry(game, entryEntered)
+		b.state.Recent = append(pruneRecent(b.state.Recent, time.Now()), time.Now().Unix())
 		duration := game.Time.Sub(time.Now())
 		timeDesc := fmt.Sprintf("Draw in %.f hour(s)", duration.Hours())
 		if duration.Minutes() < 60 {
 			timeDesc = fmt.Sprintf("Draw in %.f minutes", duration.Minutes())
 		}
 
-		b.addDigest(fmt.Sprintf("%s. Apply for %d : %s. %s", time.Now().Format("15:04:05"), game.GID, game.Name, timeDesc))
+		if game.Apps > 0 {
+			timeDesc += fmt.Sprintf(". Bundle apps %d/%d: %s", len(game.Matched), game.Apps, joinIDs(game.Matched))
+		}
+
+		origin := "rules"
+		if whitelisted {
+			origin = wg.Label()
+		}
+
+		b.addEvent(eventEntry, map[string]any{
+			"source": src.Type, "sgid": game.SGID, "gid": game.GID, "name": game.Name, "points": game.Points,
+			"origin": origin, "ends": game.Time.Unix(), "apps": game.Apps, "matched": game.Matched,
+		}, fmt.Sprintf("[%s] Apply for %d : %s (%dP, %s). %s", src.Type, game.GID, game.Name, game.Points, origin, timeDesc))
 		entries = entries + 1
 	}
 
 	return entries
 }
 
-func (b *TheBot) parseGiveaways(externalGamesList map[uint64]bool) (err error) {
+// sgPageURL builds url of listing page. main page continues as search pages
+func sgPageURL(path string, page int) string {
+	if page <= 1 {
+		return baseURL + path
+	}
+
+	if path == "" {
+		path = sgSearchURL
+	}
+
+	pageURL, err := url.Parse(baseURL + path)
+	if err != nil {
+		return baseURL + path
+	}
+
+	q := pageURL.Query()
+	q.Set("page", strconv.Itoa(page))
+	pageURL.RawQuery = q.Encode()
+
+	return pageURL.String()
+}
+
+// hasNextPage checks pagination widget for pages after the current one
+func hasNextPage(doc *goquery.Document, page int) (next bool) {
+	doc.Find("div.pagination__navigation a[data-page-number]").EachWithBreak(func(idx int, s *goquery.Selection) bool {
+		n, _ := strconv.Atoi(s.AttrOr("data-page-number", ""))
+		next = n > page
+		return !next
+	})
+	return
+}
+
+// fetchGiveaways walks listing pages and collects whitelisted giveaways not entered yet
+func (b *TheBot) fetchGiveaways(ctx context.Context, src Source) (giveaways []GiveAway, token string, err error) {
+	path := sourcePaths[src.Type]
+	maxPages := b.maxPages
+	if src.Pages > 0 {
+		maxPages = src.Pages
+	}
+
+	seen := make(map[string]bool)
+	started := time.Now()
+	for page := 1; ; page++ {
+		doc, err := b.getPageCustom(ctx, sgPageURL(path, page))
+		if err != nil {
+			if page == 1 {
+				return nil, "", err
+			}
+			errlog.Println("can't fetch page", page, err)
+			break
+		}
+
+		if page == 1 {
+			token, err = b.getToken(doc)
+			if err != nil {
+				return nil, "", err
+			}
+			b.updatePoints(doc)
+		}
+
+		found := b.getGiveaways(ctx, doc)
+		for _, ga := range found {
+			if seen[ga.SGID] || b.history.entered(ga.SGID) {
+				continue
+			}
+			seen[ga.SGID] = true
+			giveaways = append(giveaways, ga)
+		}
+		stdlog.Printf("found giveaways on page %d: %d", page, len(found))
+
+		if !hasNextPage(doc, page) {
+			break
+		}
+		if maxPages > 0 && page >= maxPages {
+			stdlog.Println("pages limit reached", maxPages)
+			break
+		}
+		if b.pagesTimeLimit > 0 && time.Since(started) >= b.pagesTimeLimit {
+			stdlog.Println("pages time limit reached", b.pagesTimeLimit)
+			break
+		}
+	}
+
+	return giveaways, token, nil
+}
+
+func (b *TheBot) parseGiveaways(ctx context.Context, externalGamesList map[uint64]*WhitelistGame) (err error) {
 	b.gamesWhitelist = externalGamesList
-	err = b.getSteamLists()
+	err = b.getSteamLists(ctx)
 	if err != nil {
 		return
 	}
 
+	err = b.excludeOwned(ctx)
+	if err != nil {
+		errlog.Println("can't exclude owned games", err)
+	}
+
 	if len(b.gamesWhitelist) == 0 {
 		stdlog.Println("there is no game you want to win, please add some in json list or steam account. bye")
 		return errors.New("empty white list")
 	}
 
-	stdlog.Println("check wishlist")
-	doc, err := b.getPageCustom(baseURL + sgWishlistURL)
+	err = b.checkWins(ctx)
 	if err != nil {
-		return
+		errlog.Println("can't check wins", err)
 	}
-	token, err := b.getToken(doc)
+
+	err = b.reconcileEntries(ctx)
 	if err != nil {
-		return
+		errlog.Println("can't reconcile entries", err)
 	}
 
-	giveaways := b.getGiveaways(doc)
-	stdlog.Println("found giveaways on page:", len(giveaways))
-	entriesWishlist := b.processGiveaways(giveaways, token, time.Hour * 24 * 7 * 5) // 5 weeks - all
-	stdlog.Println("processed giveaways", entriesWishlist)
+	stats := make([]string, 0, len(b.sources)+1)
 
-	stdlog.Println("check main page")
-	doc, err = b.getPageCustom(baseURL)
-	if err != nil {
-		return
-	}
-	token, err = b.getToken(doc)
-	if err != nil {
-		return
+	defer func() { stdlog.Printf("processed giveaways (%s)", strings.Join(stats, ", ")) }()
+
+	for _, src := range b.sources {
+		if timeIsOver(ctx) {
+			stdlog.Println("no time left for sources. stop")
+			return nil
+		}
+
+		stdlog.Println("check source", src.Type)
+		giveaways, token, err := b.fetchGiveaways(ctx, src)
+		if errors.Is(err, ErrAuthExpired) || errors.Is(err, ErrRateLimited) {
+			return err
+		}
+		if err != nil {
+			// failed source doesn't stop others
+			errlog.Println("can't check source", src.Type, err)
+			b.addEvent(eventError, map[string]any{"source": src.Type, "error": err.Error()},
+				fmt.Sprintf("[%s] Can't check source. %v", src.Type, err))
+			stats = append(stats, fmt.Sprintf("%s: failed", src.Type))
+			continue
+		}
+
+		stdlog.Println("found giveaways:", len(giveaways))
+		entries := b.processGiveaways(ctx, src, giveaways, token)
+		stats = append(stats, fmt.Sprintf("%s: %d", src.Type, entries))
 	}
 
-	giveaways = b.getGiveaways(doc)
-	stdlog.Println("found giveaways on page:", len(giveaways))
-	entriesMainPage := b.processGiveaways(giveaways, token, time.Hour)
+	if timeIsOver(ctx) {
+		stdlog.Println("no time left for search. stop")
+		return nil
+	}
 
-	defer stdlog.Printf("processed giveaways (w: %d, m: %d)", entriesWishlist, entriesMainPage)
+	giveaways, token := b.searchGames(ctx)
+	stdlog.Println("found giveaways by search:", len(giveaways))
+	entriesSearch := b.processGiveaways(ctx, Source{Type: sourceSearch, window: allGiveawaysWindow}, giveaways, token)
+	stats = append(stats, fmt.Sprintf("%s: %d", sourceSearch, entriesSearch))
 
 	return nil
 }
 
-func (b *TheBot) addDigest(msg string) {
-	b.digest = append(b.digest, msg)
+func (b *TheBot) addEvent(kind string, payload map[string]any, text string) {
+	b.digest = append(b.digest, newEvent(kind, payload, text))
 }
 
 func init() {
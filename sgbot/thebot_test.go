@@ -0,0 +1,703 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// fixtureNow - time golden files were made at
+var fixtureNow = time.Unix(1700000000, 0)
+
+// loadFixture renders page from testdata. {{ts "2h"}} in page is unix time relative to now
+func loadFixture(t *testing.T, name string, now time.Time, points int) []byte {
+	t.Helper()
+
+	funcs := template.FuncMap{
+		"ts": func(d string) (int64, error) {
+			shift, err := time.ParseDuration(d)
+			return now.Add(shift).Unix(), err
+		},
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).ParseFiles(
+		filepath.Join("testdata", "sg_header.tmpl"),
+		filepath.Join("testdata", name),
+	)
+	if err != nil {
+		t.Fatalf("can't parse fixture %s: %v", name, err)
+	}
+
+	var out bytes.Buffer
+	err = tmpl.ExecuteTemplate(&out, name, struct{ Points int }{points})
+	if err != nil {
+		t.Fatalf("can't render fixture %s: %v", name, err)
+	}
+	return out.Bytes()
+}
+
+func loadDocument(t *testing.T, name string) *goquery.Document {
+	t.Helper()
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(loadFixture(t, name, fixtureNow, 120)))
+	if err != nil {
+		t.Fatalf("can't parse document %s: %v", name, err)
+	}
+	return doc
+}
+
+// checkGolden compares value with testdata/golden/<name>.json (rewrites it with -update)
+func checkGolden(t *testing.T, name string, value any) {
+	t.Helper()
+
+	got, err := json.MarshalIndent(value, "", "\t")
+	if err != nil {
+		t.Fatalf("can't marshal %s: %v", name, err)
+	}
+	got = append(got, '\n')
+
+	golden := filepath.Join("testdata", "golden", name+".json")
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("can't update golden file: %v", err)
+		}
+	}
+
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("can't read golden file: %v", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from golden file:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+// fakeSteam serves steam api and store pages from testdata
+func fakeSteam(t *testing.T) http.Handler {
+	file := func(name string, contentType string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			raw, err := os.ReadFile(filepath.Join("testdata", name))
+			if err != nil {
+				t.Errorf("can't read %s: %v", name, err)
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.Write(raw)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/IWishlistService/GetWishlist/v1", file("steam_wishlist.json", "application/json"))
+	mux.HandleFunc("/IStoreService/GetGamesFollowed/v1/", file("steam_followed.json", "application/json"))
+	mux.HandleFunc("/sub/5000/", file("steam_sub_5000.html", "text/html"))
+	mux.HandleFunc("/ISteamUser/GetPlayerSummaries/v2/", file("steam_player.json", "application/json"))
+	mux.HandleFunc("/ISteamUser/ResolveVanityURL/v1/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("vanityurl") != "tester" {
+			w.Write([]byte(`{"response":{"success":42,"message":"No match"}}`))
+			return
+		}
+		file("steam_vanity.json", "application/json")(w, r)
+	})
+	mux.HandleFunc("/IPlayerService/GetOwnedGames/v1/", file("steam_owned.json", "application/json"))
+	mux.HandleFunc("/IFamilyGroupsService/GetFamilyGroupForUser/v1/", file("steam_family_group.json", "application/json"))
+	mux.HandleFunc("/IFamilyGroupsService/GetSharedLibraryApps/v1/", file("steam_family_apps.json", "application/json"))
+	mux.HandleFunc("/api/packagedetails", file("steam_packagedetails.json", "application/json"))
+	return mux
+}
+
+func newTestBot(t *testing.T, whitelist ...uint64) *TheBot {
+	t.Helper()
+
+	b := &TheBot{}
+	err := b.InitBot("76561190000000000", "key", newMemoryFetcher(http.NotFoundHandler()))
+	if err != nil {
+		t.Fatalf("can't init bot: %v", err)
+	}
+	b.setSteamClient(&http.Client{Transport: handlerTransport{fakeSteam(t)}})
+
+	for _, gid := range whitelist {
+		b.whitelistGame(gid, listManual)
+	}
+	return b
+}
+
+// utc makes giveaways times independent from local timezone
+func utc(giveaways []GiveAway) []GiveAway {
+	for i := range giveaways {
+		giveaways[i].Time = giveaways[i].Time.UTC()
+		giveaways[i].Created = giveaways[i].Created.UTC()
+	}
+	return giveaways
+}
+
+func TestGetGiveaways(t *testing.T) {
+	b := newTestBot(t, 100, 200, 400, 600, 800)
+
+	for _, page := range []string{"sg_wishlist_1", "sg_wishlist_2", "sg_main"} {
+		t.Run(page, func(t *testing.T) {
+			giveaways := b.getGiveaways(context.Background(), loadDocument(t, page+".html"))
+			checkGolden(t, "giveaways_"+page, utc(giveaways))
+		})
+	}
+}
+
+func TestGetGiveawaysNotWhitelisted(t *testing.T) {
+	b := newTestBot(t, 999)
+
+	giveaways := b.getGiveaways(context.Background(), loadDocument(t, "sg_wishlist_1.html"))
+	if len(giveaways) != 0 {
+		t.Errorf("expected no giveaways, got %+v", giveaways)
+	}
+}
+
+func TestGetToken(t *testing.T) {
+	b := newTestBot(t)
+
+	token, err := b.getToken(loadDocument(t, "sg_wishlist_1.html"))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if token != "0123456789abcdef0123456789abcdef" {
+		t.Errorf("unexpected token %q", token)
+	}
+
+	_, err = b.getToken(loadDocument(t, "sg_logged_out.html"))
+	if err == nil {
+		t.Errorf("expected error for logged out page")
+	}
+}
+
+func TestParseToken(t *testing.T) {
+	b := &TheBot{}
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"do=logout&xsrf_token=0123456789abcdef0123456789abcdef", "0123456789abcdef0123456789abcdef"},
+		{"xsrf_token=ffffffffffffffffffffffffffffffff", "ffffffffffffffffffffffffffffffff"},
+	}
+
+	for _, tt := range tests {
+		if got := b.parseToken(tt.in); got != tt.want {
+			t.Errorf("parseToken(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestHasNextPage(t *testing.T) {
+	if !hasNextPage(loadDocument(t, "sg_wishlist_1.html"), 1) {
+		t.Errorf("first wishlist page has next page")
+	}
+	if hasNextPage(loadDocument(t, "sg_wishlist_2.html"), 2) {
+		t.Errorf("second wishlist page is the last one")
+	}
+	if hasNextPage(loadDocument(t, "sg_main.html"), 1) {
+		t.Errorf("main page is the only one")
+	}
+}
+
+func TestGetWins(t *testing.T) {
+	wins := getWins(loadDocument(t, "sg_won.html"))
+	for i := range wins {
+		wins[i].Time = wins[i].Time.UTC()
+	}
+	checkGolden(t, "wins", wins)
+}
+
+func TestCheckWins(t *testing.T) {
+	b := newTestBot(t)
+	b.client = newMemoryFetcher(&fakeSteamGifts{t: t})
+	b.setCookies([]*http.Cookie{{Name: "PHPSESSID", Value: "session", Domain: "www.steamgifts.com", Path: "/"}})
+	old := time.Now().Add(-winsKeep - time.Hour).Unix()
+	b.state.Wins = map[string]int64{"wWwW1": old, "oOoO1": old, "rRrR1": time.Now().Unix()}
+
+	err := b.checkWins(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// old win on the page is kept, old one off the page is forgotten
+	if _, ok := b.state.Wins["oOoO1"]; ok || len(b.state.Wins) != 2 || b.state.Wins["wWwW1"] != old {
+		t.Errorf("unexpected wins %v", b.state.Wins)
+	}
+	if len(b.digest) != 0 {
+		t.Errorf("known win is reported again %+v", b.digest)
+	}
+}
+
+func TestEntryErrorKinds(t *testing.T) {
+	messages := []struct {
+		msg  string
+		want error
+	}{
+		{"Not Enough Points", ErrInsufficientPoints},
+		{"Your contributor level is too low", ErrLevelTooLow},
+		{"Previously Won", ErrEntryRejected},
+		{"This giveaway has ended", ErrGiveawayEnded},
+		{"This giveaway is region restricted", ErrRegionRestricted},
+	}
+	for _, tt := range messages {
+		if got := messageKind(tt.msg); got != tt.want {
+			t.Errorf("messageKind(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+
+	statuses := []struct {
+		status int
+		want   error
+	}{
+		{http.StatusOK, nil},
+		{http.StatusForbidden, ErrAuthExpired},
+		{http.StatusTooManyRequests, ErrRateLimited},
+		{http.StatusUnprocessableEntity, ErrEntryRejected},
+		{http.StatusBadGateway, ErrUnavailable},
+		{http.StatusBadRequest, ErrEntryRejected},
+	}
+	for _, tt := range statuses {
+		if got := statusKind(tt.status); got != tt.want {
+			t.Errorf("statusKind(%d) = %v, want %v", tt.status, got, tt.want)
+		}
+	}
+
+	err := error(&BotError{When: fixtureNow, What: "Not Enough Points", Err: ErrInsufficientPoints})
+	if !errors.Is(err, ErrInsufficientPoints) || fatalEntryError(err) {
+		t.Errorf("unexpected kind of %v", err)
+	}
+}
+
+func TestEnterRejected(t *testing.T) {
+	sg := &fakeSteamGifts{t: t, points: 120, costs: map[string]int{"aAaA1": 10}}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") == "bBbB2" {
+			w.WriteHeader(http.StatusUnprocessableEntity)
+			w.Write([]byte(`{"type":"error","msg":"Already Entered"}`))
+			return
+		}
+		sg.ServeHTTP(w, r)
+	})
+	b := newTestBot(t, 100, 200)
+	b.client = newMemoryFetcher(handler)
+	b.setCookies([]*http.Cookie{{Name: "PHPSESSID", Value: "session", Domain: "www.steamgifts.com", Path: "/"}})
+	pacing, _ := parsePacing(noPauses)
+	b.setPacing(pacing)
+	b.points = 120
+	src := Source{Type: sourceWishlist, window: time.Hour}
+	ends := time.Now().Add(30 * time.Minute)
+	giveaways := []GiveAway{{SGID: "aAaA1", GID: 100, Points: 10, Time: ends}, {SGID: "bBbB2", GID: 200, Points: 5, Time: ends}}
+
+	// bare 422 (bad token) fails the entry, 422 with message is classified by it
+	if n := b.processGiveaways(context.Background(), src, giveaways, "bad token"); n != 0 || len(sg.entered) != 0 {
+		t.Fatalf("entered %d %v with bad token", n, sg.entered)
+	}
+	if e := b.history.entries["aAaA1"]; e == nil || e.Result != entryFailed {
+		t.Errorf("rejected entry %+v, want failed", e)
+	}
+	if !b.history.entered("bBbB2") {
+		t.Errorf("already entered giveaway isn't recorded %+v", b.history.entries["bBbB2"])
+	}
+
+	// failed entry is retried
+	if n := b.processGiveaways(context.Background(), src, giveaways, "0123456789abcdef0123456789abcdef"); n != 1 || !b.history.entered("aAaA1") {
+		t.Errorf("entered %d, history %+v", n, b.history.entries["aAaA1"])
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	calls := map[string]int{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.Method]++
+		if calls[r.Method] == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+
+	policy := RetryPolicy{Attempts: 3}
+	client := newSteamClient(handlerTransport{handler}, policy)
+
+	resp, err := client.Get("https://store.steampowered.com/sub/5000/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || calls[http.MethodGet] != 2 {
+		t.Errorf("GET is expected to be repeated once, got status %d after %d calls", resp.StatusCode, calls[http.MethodGet])
+	}
+
+	fetcher := &retryFetcher{Fetcher: newMemoryFetcher(handler), policy: policy}
+	answer, err := fetcher.Post(context.Background(), baseURL+"/ajax.php", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if answer.StatusCode != http.StatusServiceUnavailable || calls[http.MethodPost] != 1 {
+		t.Errorf("sent POST is not expected to be repeated, got status %d after %d calls", answer.StatusCode, calls[http.MethodPost])
+	}
+
+	if !notSent(&net.OpError{Op: "dial", Err: errors.New("connection refused")}) {
+		t.Errorf("dial error means request was not sent")
+	}
+}
+
+func TestResolvePackage(t *testing.T) {
+	b := newTestBot(t)
+	link := "https://store.steampowered.com/sub/5000/"
+
+	apps, err := b.resolvePackage(context.Background(), link)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(apps, []uint64{400, 401}) {
+		t.Errorf("unexpected package apps %v", apps)
+	}
+
+	// cached package is not requested again
+	b.setSteamClient(&http.Client{Transport: handlerTransport{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("unexpected request %s", r.URL)
+		w.WriteHeader(http.StatusInternalServerError)
+	})}})
+	if apps, err = b.resolvePackage(context.Background(), link); err != nil || len(apps) != 2 {
+		t.Errorf("cached package apps %v, error %v", apps, err)
+	}
+
+	// expired package falls back to store page if api has no details
+	b.state.Packages[5000].Time = fixtureNow.Unix()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/packagedetails", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"5000":{"success":false}}`))
+	})
+	mux.Handle("/sub/5000/", fakeSteam(t))
+	b.setSteamClient(&http.Client{Transport: handlerTransport{mux}})
+	apps, err = b.resolvePackage(context.Background(), link)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !slices.Equal(apps, []uint64{400, 401}) || b.state.Packages[5000].Time == fixtureNow.Unix() {
+		t.Errorf("unexpected package apps %v (%+v)", apps, b.state.Packages[5000])
+	}
+}
+
+func TestBundlePolicy(t *testing.T) {
+	bundle := GiveAway{GID: 401, Apps: 4, Primary: 400, Matched: []uint64{401}}
+	single := GiveAway{GID: 100}
+
+	tests := []struct {
+		policy *BundlePolicy
+		want   bool
+	}{
+		{nil, true},
+		{&BundlePolicy{}, true},
+		{&BundlePolicy{MinApps: 2}, false},
+		{&BundlePolicy{MinPercent: 25}, true},
+		{&BundlePolicy{MinPercent: 50}, false},
+		{&BundlePolicy{Primary: true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.allows(bundle); got != tt.want {
+			t.Errorf("%+v allows bundle = %v, want %v", tt.policy, got, tt.want)
+		}
+		if !tt.policy.allows(single) {
+			t.Errorf("%+v doesn't allow single game", tt.policy)
+		}
+	}
+
+	bundle.Matched = []uint64{400, 401}
+	if !(&BundlePolicy{MinApps: 2, MinPercent: 50, Primary: true}).allows(bundle) {
+		t.Errorf("bundle with primary app and half of apps whitelisted isn't allowed")
+	}
+}
+
+func TestExcludeOwned(t *testing.T) {
+	b := newTestBot(t, 100, 200, 400, 800)
+	b.setFamilySharing(true)
+	b.state.Owned = map[uint64]int64{800: fixtureNow.Unix()}
+
+	err := b.excludeOwned(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, ok := b.gamesWhitelist[100]; len(b.gamesWhitelist) != 1 || !ok {
+		t.Errorf("unexpected whitelist %v", b.gamesWhitelist)
+	}
+	if len(b.state.Owned) != 3 || b.state.Owned[800] != fixtureNow.Unix() {
+		t.Errorf("unexpected owned games %v", b.state.Owned)
+	}
+
+	// 800 was known as owned already
+	if len(b.digest) != 2 {
+		t.Errorf("digest %+v, want 2 events", b.digest)
+	}
+	for _, e := range b.digest {
+		if e.Kind != eventOwned || !strings.Contains(e.Text, "skipped, already owned") {
+			t.Errorf("unexpected digest event %+v", e)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	raw, err := loadRules(filepath.Join("testdata", "rules.json"))
+	if err != nil {
+		t.Fatalf("can't load rules: %v", err)
+	}
+	rules, err := parseRules(raw)
+	if err != nil {
+		t.Fatalf("can't parse rules: %v", err)
+	}
+	if rules[0].Title != "no bad creators" || rules[1].Title != "cheap followed" {
+		t.Errorf("rules aren't sorted by priority: %+v", rules)
+	}
+
+	followed := []string{listFollowed}
+	tests := []struct {
+		ga          GiveAway
+		lists       []string
+		whitelisted bool
+		want        bool
+	}{
+		{GiveAway{GID: 400, Points: 15, Time: fixtureNow.Add(time.Hour)}, followed, true, true},
+		{GiveAway{GID: 400, Points: 25, Time: fixtureNow.Add(time.Hour)}, followed, true, false},
+		{GiveAway{GID: 400, Points: 5, Creator: "Creator6", Time: fixtureNow.Add(time.Hour)}, followed, true, false},
+		{GiveAway{GID: 100, Points: 50, Time: fixtureNow.Add(time.Hour)}, []string{listWishlist}, true, true},
+		{GiveAway{GID: 700, Points: 50, Time: fixtureNow.Add(time.Hour)}, nil, false, true},
+		{GiveAway{GID: 700, Points: 50, Time: fixtureNow.Add(72 * time.Hour)}, nil, false, false},
+	}
+	for _, tt := range tests {
+		if got, rule := rules.decide(tt.ga, sourceAll, tt.lists, tt.whitelisted, fixtureNow); got != tt.want {
+			t.Errorf("decide(%+v, %v) = %v by %+v, want %v", tt.ga, tt.lists, got, rule, tt.want)
+		}
+	}
+
+	if !rules.mayInclude(700, "Zeta") || rules.mayInclude(900, "Theta") {
+		t.Errorf("only app 700 may be included by rules")
+	}
+
+	if _, err = parseRules([]Rule{{Action: "enter"}}); err == nil {
+		t.Errorf("expected error for unknown action")
+	}
+}
+
+func TestRankTopWishlist(t *testing.T) {
+	b := newTestBot(t)
+	b.setScoring(scoreChance)
+	b.setPacing(Pacing{Ordered: true})
+	for gid, priority := range map[uint64]int{100: 12, 200: 2, 300: 2, 400: 0} {
+		game := b.whitelistGame(gid, listWishlist)
+		game.Priority = priority
+		game.Added = fixtureNow.Add(time.Duration(gid) * time.Hour)
+	}
+	b.whitelistGame(500, listFollowed)
+
+	ends := time.Now().Add(time.Hour)
+	giveaways := []GiveAway{
+		{SGID: "a", GID: 100, Points: 1, Copies: 1, Time: ends},
+		{SGID: "b", GID: 300, Points: 50, Copies: 1, Entries: 1000, Time: ends},
+		{SGID: "c", GID: 200, Points: 50, Copies: 1, Entries: 1000, Time: ends},
+		{SGID: "d", GID: 500, Points: 2, Copies: 1, Time: ends},
+	}
+	b.rankGiveaways(giveaways)
+
+	got := make([]string, 0, len(giveaways))
+	for _, ga := range giveaways {
+		got = append(got, ga.SGID)
+	}
+	if want := []string{"c", "b", "a", "d"}; !slices.Equal(got, want) {
+		t.Errorf("ranked %v, want %v", got, want)
+	}
+
+	if label := b.gamesWhitelist[200].Label(); label != "wishlist #2" {
+		t.Errorf("unexpected label %q", label)
+	}
+}
+
+func TestUpdatePoints(t *testing.T) {
+	b := newTestBot(t)
+	b.updatePoints(loadDocument(t, "sg_main.html"))
+	if b.points != 120 {
+		t.Errorf("points %d, want 120", b.points)
+	}
+
+	// balance isn't lost on page without header
+	b.updatePoints(loadDocument(t, "sg_logged_out.html"))
+	if b.points != 120 {
+		t.Errorf("points %d after page without balance", b.points)
+	}
+}
+
+func TestAffordable(t *testing.T) {
+	b := newTestBot(t, 300)
+	b.whitelistGame(100, listWishlist)
+	b.whitelistGame(200, listFollowed)
+	b.setPointsReserve(30, time.Hour)
+
+	soon, later := time.Now().Add(30*time.Minute), time.Now().Add(48*time.Hour)
+	cases := []struct {
+		game GiveAway
+		want bool
+	}{
+		{GiveAway{GID: 100, Points: 40, Time: soon}, true},                          // wishlist ends soon - reserve is spent
+		{GiveAway{GID: 100, Points: 40, Time: later}, false},                        // wishlist with days left
+		{GiveAway{GID: 100, Points: 20, Time: later}, true},                         // affordable without reserve
+		{GiveAway{GID: 200, Points: 40, Time: soon}, false},                         // not wishlisted
+		{GiveAway{GID: 5000, Points: 40, Time: soon, Matched: []uint64{100}}, true}, // package with wishlisted app
+		{GiveAway{GID: 100, Points: 60, Time: soon}, false},                         // more than balance
+	}
+
+	b.points = 50
+	for _, c := range cases {
+		if got := b.affordable(c.game); got != c.want {
+			t.Errorf("affordable %+v = %v, want %v", c.game, got, c.want)
+		}
+	}
+
+	b.points = -1
+	if !b.affordable(GiveAway{GID: 300, Points: 100, Time: later}) {
+		t.Errorf("unknown balance doesn't limit entries")
+	}
+}
+
+func TestSearchBatch(t *testing.T) {
+	b := newTestBot(t, 100, 200, 300, 400, 500)
+	b.setSearch(3, searchByApp, 24*time.Hour, nil)
+	now := time.Now()
+	b.state.Searched = map[uint64]int64{
+		100: now.Add(-30 * time.Hour).Unix(),
+		200: now.Add(-time.Hour).Unix(), // searched recently
+		300: now.Add(-48 * time.Hour).Unix(),
+		900: now.Add(-time.Hour).Unix(), // not whitelisted anymore
+	}
+
+	// never searched first, then least recently searched, limited with budget
+	if batch := b.searchBatch(); !slices.Equal(batch, []uint64{400, 500, 300}) {
+		t.Errorf("batch %v", batch)
+	}
+	if _, ok := b.state.Searched[900]; ok || len(b.state.Searched) != 3 {
+		t.Errorf("searches aren't pruned %v", b.state.Searched)
+	}
+
+	b.setSearch(0, searchByApp, 24*time.Hour, nil)
+	if batch := b.searchBatch(); len(batch) != 0 {
+		t.Errorf("search is disabled, batch %v", batch)
+	}
+}
+
+func TestReconcileEntries(t *testing.T) {
+	now := time.Now()
+	day := 24 * time.Hour
+	fetched := 0
+	// page N lists giveaway pN entered N days ago, there are more pages than listing limit
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		page = max(page, 1)
+		fetched = max(fetched, page)
+		body := string(loadFixture(t, "sg_entered.html", now.Add(-time.Duration(page)*day), 120))
+		body = strings.Replace(body, "bBbB2", fmt.Sprintf("p%d", page), 1)
+		body = strings.Replace(body, `<div class="pagination__navigation"></div>`,
+			fmt.Sprintf(`<div class="pagination__navigation"><a href="?page=%d" data-page-number="%d">Next</a></div>`, page+1, page+1), 1)
+		w.Write([]byte(body))
+	})
+
+	b := newTestBot(t)
+	b.client = newMemoryFetcher(handler)
+	b.setPagination(3, 0)
+	ends := now.Add(day).Unix()
+	entered := func(d time.Duration) int64 { return now.Add(-d).Unix() }
+	b.setHistory(newEntryHistory([]Entry{
+		{SGID: "p1", Time: entered(day + time.Hour), Ends: ends, Result: entryEntered},
+		{SGID: "p5", Time: entered(5*day + time.Hour), Ends: ends, Result: entryFailed},
+		{SGID: "gone", Time: entered(2 * day), Ends: ends, Result: entryEntered},
+		{SGID: "ended", Time: entered(30 * day), Ends: now.Add(-day).Unix(), Result: entryEntered},
+	}), time.Hour)
+
+	if err := b.reconcileEntries(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// walked past the oldest not ended entry, but not to the ended one
+	if fetched != 6 {
+		t.Errorf("fetched %d pages, want 6", fetched)
+	}
+	for sgid, want := range map[string]string{"p1": entryEntered, "p5": entryEntered, "gone": entryWithdrawn, "ended": entryEntered} {
+		if got := b.history.entries[sgid].Result; got != want {
+			t.Errorf("%s result %q, want %q", sgid, got, want)
+		}
+	}
+	if b.state.Reconciled == 0 {
+		t.Error("reconcile time isn't saved")
+	}
+}
+
+func TestParseSteamProfile(t *testing.T) {
+	tests := []struct {
+		in      string
+		steamID string
+		vanity  string
+	}{
+		{"76561190000000000", "76561190000000000", ""},
+		{"https://steamcommunity.com/profiles/76561190000000000/", "76561190000000000", ""},
+		{"https://steamcommunity.com/id/tester/", "", "tester"},
+		{"tester", "", "tester"},
+	}
+	for _, tt := range tests {
+		steamID, vanity, err := parseSteamProfile(tt.in)
+		if err != nil || steamID != tt.steamID || vanity != tt.vanity {
+			t.Errorf("parseSteamProfile(%q) = %q, %q, %v", tt.in, steamID, vanity, err)
+		}
+	}
+
+	for _, in := range []string{"", "https://steamcommunity.com/profiles/123/", "not a profile"} {
+		if _, _, err := parseSteamProfile(in); !errors.Is(err, ErrMisconfigured) {
+			t.Errorf("parseSteamProfile(%q) error %v, want misconfigured", in, err)
+		}
+	}
+}
+
+func TestCheckProfile(t *testing.T) {
+	b := &TheBot{}
+	err := b.InitBot("https://steamcommunity.com/id/tester/", "key", newMemoryFetcher(http.NotFoundHandler()))
+	if err != nil {
+		t.Fatalf("can't init bot: %v", err)
+	}
+	b.setSteamClient(&http.Client{Transport: handlerTransport{fakeSteam(t)}})
+
+	if err = b.checkProfile(context.Background()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if b.steamID != "76561190000000000" {
+		t.Errorf("vanity name is resolved to %q", b.steamID)
+	}
+
+	b = newTestBot(t)
+	b.steamVanity = "nobody"
+	if err = b.checkProfile(context.Background()); !errors.Is(err, ErrMisconfigured) {
+		t.Errorf("unexpected error for unknown vanity name: %v", err)
+	}
+
+	b = newTestBot(t)
+	b.setSteamClient(&http.Client{Transport: handlerTransport{http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	})}})
+	if err = b.checkProfile(context.Background()); !errors.Is(err, ErrMisconfigured) || !strings.Contains(err.Error(), "api key") {
+		t.Errorf("unexpected error for invalid api key: %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	// lists whitelisted games come from
+	listWishlist string = "wishlist"
+	listFollowed string = "followed"
+	listManual   string = "manual" // games table
+
+	defaultTopWishlist int = 10
+)
+
+// WhitelistGame what is known about whitelisted game
+type WhitelistGame struct {
+	Lists    []string  // lists the game is in: wishlist, followed or manual
+	Priority int       // wishlist priority (1 - top, 0 - not in wishlist or not ranked)
+	Added    time.Time // when the game was added to wishlist
+	Name     string
+}
+
+// Label tells where the game comes from, like "wishlist #3, followed"
+func (g *WhitelistGame) Label() string {
+	labels := make([]string, 0, len(g.Lists))
+	for _, list := range g.Lists {
+		if list == listWishlist && g.Priority > 0 {
+			list = fmt.Sprintf("%s #%d", list, g.Priority)
+		}
+		labels = append(labels, list)
+	}
+	return strings.Join(labels, ", ")
+}
+
+// whitelistGame adds game to the list (if it's not there yet)
+func (b *TheBot) whitelistGame(gid uint64, list string) *WhitelistGame {
+	game, ok := b.gamesWhitelist[gid]
+	if !ok {
+		game = &WhitelistGame{}
+		b.gamesWhitelist[gid] = game
+	}
+
+	for _, l := range game.Lists {
+		if l == list {
+			return game
+		}
+	}
+	game.Lists = append(game.Lists, list)
+	return game
+}
+
+// wishlistPriority of the game, 0 - not in wishlist or not ranked
+func (b *TheBot) wishlistPriority(gid uint64) int {
+	if game, ok := b.gamesWhitelist[gid]; ok {
+		return game.Priority
+	}
+	return 0
+}
+
+// topWishlistGame means the game is entered before others
+func (b *TheBot) topWishlistGame(gid uint64) bool {
+	priority := b.wishlistPriority(gid)
+	return priority > 0 && priority <= b.topWishlist
+}
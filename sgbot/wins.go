@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Win giveaway won by the account
+type Win struct {
+	SGID     string
+	Name     string
+	Creator  string
+	Received bool // key (gift) received
+	Time     time.Time
+}
+
+// getWins parses won giveaways page
+func getWins(doc *goquery.Document) (wins []Win) {
+	doc.Find("div.table__row-outer-wrap").Each(func(idx int, s *goquery.Selection) {
+		href, ok := s.Find("a.table__column__heading").First().Attr("href")
+		if !ok {
+			return
+		}
+
+		parts := strings.Split(href, "/")
+		if len(parts) < 3 {
+			errlog.Println("skip win - unexpected url", href)
+			return
+		}
+
+		win := Win{
+			SGID:    parts[2],
+			Name:    strings.TrimSpace(s.Find("a.table__column__heading").First().Text()),
+			Creator: strings.TrimSpace(s.Find("a[href^='/user/']").First().Text()),
+		}
+
+		if y, ok := s.Find("span[data-timestamp]").First().Attr("data-timestamp"); ok {
+			t, _ := strconv.ParseInt(y, 10, 64)
+			win.Time = time.Unix(t, 0)
+		}
+
+		// key is shown in the row or with 'view key' button, gifts are marked as received
+		win.Received = strings.TrimSpace(s.Find(".table__column__key").Text()) != "" ||
+			s.Find(".view_key_btn").Length() > 0 ||
+			s.Find("div.table__gift-feedback-received").Not(".is-hidden").Length() > 0
+
+		wins = append(wins, win)
+	})
+
+	return
+}
+
+// winsKeep known wins are forgotten after this time if they aren't on won page
+const winsKeep = 90 * 24 * time.Hour
+
+// checkWins finds wins not known yet and reports them. wins found on the first check are remembered silently
+func (b *TheBot) checkWins(ctx context.Context) error {
+	doc, err := b.getPageCustom(ctx, baseURL+sgAccountInfo)
+	if err != nil {
+		return err
+	}
+	if _, err = b.getToken(doc); err != nil {
+		return err
+	}
+
+	wins := getWins(doc)
+	firstCheck := b.state.Wins == nil
+	if firstCheck {
+		b.state.Wins = make(map[string]int64)
+	}
+
+	for _, win := range wins {
+		if _, ok := b.state.Wins[win.SGID]; ok {
+			continue
+		}
+		b.state.Wins[win.SGID] = time.Now().Unix()
+
+		if firstCheck {
+			continue
+		}
+
+		stdlog.Printf("new win [%+v]", win)
+		received := "not received yet"
+		if win.Received {
+			received = "received"
+		}
+		b.addEvent(eventWin, map[string]any{
+			"sgid": win.SGID, "name": win.Name, "creator": win.Creator, "ended": win.Time.Unix(), "received": win.Received,
+		}, fmt.Sprintf("!!! YOU WON %s from %s (%s). Key %s", win.Name, win.Creator, win.Time.Format("2006-01-02"), received))
+	}
+
+	// old wins which are off the page aren't reported again
+	for sgid, seen := range b.state.Wins {
+		if !slices.ContainsFunc(wins, func(w Win) bool { return w.SGID == sgid }) && time.Since(time.Unix(seen, 0)) > winsKeep {
+			delete(b.state.Wins, sgid)
+		}
+	}
+
+	stdlog.Println("wins on page:", len(wins))
+	return nil
+}
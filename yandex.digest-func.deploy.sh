@@ -3,4 +3,5 @@
 cd sgbot
 
 D=$(date '+%F_%H-%M-%S')
-zip ../digest-$D.zip digest-func.go go.mod func-response.go
+# storage is shared with bot function
+zip ../digest-$D.zip digest-func.go bot-func.go thebot.go go.mod func-response.go sorter.go fetcher.go fetcher-zenrows.go state.go search.go sources.go scoring.go wins.go entries.go errors.go retry.go pacing.go packages.go owned.go rules.go whitelist.go profile.go accounts.go storage.go storage-ydb.go storage-json.go migrations.go events.go
@@ -3,4 +3,9 @@
 cd sgbot
 
 D=$(date '+%F_%H-%M-%S')
-zip ../sgbot-$D.zip bot-func.go thebot.go go.mod func-response.go sorter.go
+zip ../sgbot-$D.zip bot-func.go thebot.go go.mod func-response.go sorter.go fetcher.go fetcher-zenrows.go state.go search.go sources.go scoring.go wins.go entries.go errors.go retry.go pacing.go packages.go owned.go rules.go whitelist.go profile.go accounts.go storage.go storage-ydb.go storage-json.go migrations.go events.go
+
+# optional rules for entering giveaways (SG_RULES_FILE=rules.json)
+if [ -f rules.json ]; then
+	zip ../sgbot-$D.zip rules.json
+fi